@@ -11,13 +11,15 @@ import (
 const (
 	cryptoWrapErrorExitCode = 1
 	otherErrorExitCode      = 2
+	sensitiveDataExitCode   = 3
 )
 
 func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Command {
 
 	var noBackup bool
 	var bkpExt string
-	ctxOpts := &terrahelp.CryptoHandlerOpts{TransformOpts: &terrahelp.TransformOpts{}}
+	ctxOpts := &terrahelp.CryptoHandlerOpts{TransformOpts: &terrahelp.TransformOpts{
+		Selection: &terrahelp.SelectionRules{}}}
 
 	return cli.Command{
 		Name:  "encrypt",
@@ -38,8 +40,8 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 			"   and TH_ENCRYPTION_MODE environment variables. Encrypted values will always conform to the following format: \n" +
 			"   @terrahelp-encrypted(ENCRYPTED_CONTENT). Decryption essentially operates in reverse. \n\n" +
 
-			"   Encryption modes: full,inline  \n" +
-			"   -----------------------------  \n" +
+			"   Encryption modes: full,inline,tfstate  \n" +
+			"   -------------------------------------  \n" +
 			"   The default encryption mode is 'full' which means the full content (of for example the .tfstate files) \n" +
 			"   will be encrypted. Quite often however it is desirable to only encrypt certain sensitive fragments within \n" +
 			"   the data, and not simply the whole content as a single unit and this is where the inline mode comes in. \n" +
@@ -48,7 +50,47 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 			"   file, which just by way of recap should NEVER be checked into version control! Terrahelp then uses the  \n" +
 			"   terraform.tfvars file to identify which values are considered sensitive, searches for any occurrence \n" +
 			"   of these values within the provided content and essentially does a find and replace of all the sensitive values \n" +
-			"   with appropriately encrypted ones. \n\n" +
+			"   with appropriately encrypted ones. The terraform.tfvars file may itself be fully or inline encrypted using \n" +
+			"   the same provider and key, in which case it is transparently decrypted in memory only. \n\n" +
+
+			"   The tfstate mode is an inline mode which understands tfstate files. Rather than replacing sensitive values \n" +
+			"   wherever they appear, it parses the state and only encrypts them within the (decoded) string values of \n" +
+			"   resource attributes and outputs, so values terraform has JSON escaped are found, and the state remains \n" +
+			"   valid JSON, with its key order and formatting untouched. Decrypt such files using the tfstate mode too. \n\n" +
+
+			"   Secrets which never appear in the terraform.tfvars file (e.g. provider generated AWS keys, PEM private \n" +
+			"   keys, JWTs, passwords within connection strings and GitHub tokens) can additionally be detected using \n" +
+			"   the built in detector rules by specifying the detect flag. Individual rules can be switched on or off \n" +
+			"   by their rule ID (aws-access-key-id, aws-secret-access-key, pem-private-key, jwt, \n" +
+			"   connection-string-password, github-token and the off by default high-entropy-string). \n\n" +
+
+			"   A tfvars file can itself be encrypted with the format flag set to tfvars, in which case each of its string values \n" +
+			"   is encrypted in place (as written, so decrypting restores the file exactly), leaving the variable names, \n" +
+			"   structure, comments and formatting visible. Only the values selected by the selection flags (e.g. include-vars, \n" +
+			"   all by default) are encrypted, and values already encrypted are left alone, so \n" +
+			"   newly added values can be encrypted by encrypting the file again. The encrypted tfvars file can be used \n" +
+			"   as is as the source of the sensitive values for mask and inline encryption. \n\n" +
+
+			"   Terraform plan files (e.g. terraform plan -out=tfplan) hold the prior state and the variable values in \n" +
+			"   plaintext. With the format flag set to binary, a plan file (or any large binary content) is encrypted in \n" +
+			"   full as it is read, in chunks, each chunk on a line of its own, whereas with the format flag set to plan, \n" +
+			"   each of its members is encrypted in full, the result remaining a zip archive listing the same members. \n\n" +
+
+			"   Alternatively, the values to encrypt within a JSON, YAML or HCL document can be selected by their path via \n" +
+			"   the select flag (e.g. outputs.*.value or data.*), each selected string value being encrypted in full and \n" +
+			"   the rest of the document (including its comments and formatting) left as is. Values already encrypted \n" +
+			"   are left alone, so newly added values can be encrypted by encrypting the document again. A path is made up of dot \n" +
+			"   separated keys, where * matches any key, followed by any number of [*], [n] or [key=value] filters, e.g. \n" +
+			"       resources[type=aws_db_instance].instances[*].attributes.password \n\n" +
+
+			"   Organisation specific secrets can be detected with user defined rules, supplied via the rules-file flag \n" +
+			"   as either HCL or YAML. Each rule has an id, a regex and optionally the capture group holding the exact \n" +
+			"   secret, and (when masking) a replacement template to use instead of the mask, e.g. \n" +
+			"       rule \"azure-sas-signature\" {\n" +
+			"         regex       = \"sig=([A-Za-z0-9%]+)\"\n" +
+			"         capture     = 1\n" +
+			"         replacement = \"REDACTED\"\n" +
+			"       }\n\n" +
 
 			"   Providers: simple,vault,vault-cli \n" +
 			"   ---------------------------------  \n" +
@@ -100,6 +142,30 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 
 			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -mode=inline -file=terraform.tfstate -file=terraform.tfstate.backup \n\n" +
 
+			"   To inline encrypt the resource attributes and outputs of the terraform.tfstate file, keeping it valid JSON:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -mode=tfstate -file=terraform.tfstate \n\n" +
+
+			"   To encrypt the values of the terraform.tfvars file, keeping its variables and structure visible:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -format=tfvars -file=terraform.tfvars \n\n" +
+
+			"   To encrypt a terraform plan file, to be passed on to a later CI stage:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -format=binary < tfplan > tfplan.enc \n\n" +
+
+			"   To encrypt each of the members of a terraform plan file in place:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -format=plan -file=tfplan \n\n" +
+
+			"   To encrypt the passwords of the aws_db_instance resources within the terraform.tfstate file:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -select='resources[type=aws_db_instance].instances[*].attributes.password' -file=terraform.tfstate \n\n" +
+
+			"   To encrypt the data of each of the Kubernetes secrets within a (multi document) YAML file:\n\n" +
+
+			"        $  terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -select='data.*' -file=secrets.yaml \n\n" +
+
 			"   To inline encrypt the output of a terraform plan using simple encryption:\n\n" +
 
 			"        $  terraform plan | terrahelp encrypt -simple-key=AES256Key-32Characters0987654321 -mode=inline\n\n" +
@@ -114,7 +180,7 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 
 			"\n",
 
-		Flags: []cli.Flag{
+		Flags: concatFlags([]cli.Flag{
 			cli.StringFlag{
 				Name:        "provider",
 				Value:       terrahelp.ThEncryptProviderSimple,
@@ -126,9 +192,17 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 				Name:        "mode",
 				Value:       terrahelp.ThEncryptModeFull,
 				EnvVar:      "TH_ENCRYPTION_MODE",
-				Usage:       fmt.Sprintf("Encryption mode (inline|full) to use"),
+				Usage:       fmt.Sprintf("Encryption mode (inline|full|tfstate) to use"),
 				Destination: &ctxOpts.EncMode,
 			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: "Format (tfvars|plan|binary) of the content, instead of encrypting as per the mode, tfvars encrypts the string values " +
+					"of the tfvars file in place, keeping its variable names, structure, comments and formatting, plan encrypts each " +
+					"of the members of the terraform plan file (zip archive) in full, and binary encrypts the content in full as it is read, " +
+					"a chunk per line",
+				Destination: &ctxOpts.Format,
+			},
 			cli.StringSliceFlag{
 				Name:  "file",
 				Usage: fmt.Sprintf("File(s) to encrypt - can be specified multiple times"),
@@ -160,6 +234,11 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 				Usage:       "Excludes the encryption of whitespace only values (defaults to true)",
 				Destination: &ctxOpts.ExcludeWhitespaceOnly,
 			},
+			cli.BoolTFlag{
+				Name:        "encoded",
+				Usage:       "Includes the encryption of base64, URL, JSON and HCL encoded forms of sensitive values (defaults to true)",
+				Destination: &ctxOpts.EncodedVariants,
+			},
 			cli.StringFlag{
 				Name:        "simple-key",
 				EnvVar:      "TH_SIMPLE_KEY",
@@ -173,12 +252,17 @@ func encryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 				Usage:       "(Vault provider only) Named encryption key to use",
 				Destination: &ctxOpts.NamedEncKey,
 			},
-		},
+		}, pathSelectFlags(ctxOpts), selectionFlags(ctxOpts.Selection), sourceFlags(), detectFlags()),
 		Action: func(c *cli.Context) {
 			th := f(ctxOpts.EncProvider)
 			err := ctxOpts.ValidateForEncryptDecrypt()
 			exitIfError(err)
 			setupTransformableItems(c, ctxOpts.TransformOpts, noBackup, bkpExt)
+			setupPathSelectors(c, ctxOpts)
+			setupSelectionRules(c, ctxOpts.Selection)
+			setupDetectors(c, ctxOpts.TransformOpts)
+			ctxOpts.Replaceables = sensitiveReplaceables(c, ctxOpts.TransformOpts, ctxOpts.ExcludeWhitespaceOnly,
+				th.Encrypter, ctxOpts.EncryptionKey())
 			err = th.Encrypt(ctxOpts)
 			exitIfError(err)
 		},
@@ -230,6 +314,22 @@ func decryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 
 			"        $  terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -mode=inline -file=terraform.tfstate -file=terraform.tfstate.backup \n\n" +
 
+			"   To decrypt a terraform.tfstate file encrypted in tfstate mode:\n\n" +
+
+			"        $  terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -mode=tfstate -file=terraform.tfstate \n\n" +
+
+			"   To decrypt a terraform plan file encrypted in the binary format:\n\n" +
+
+			"        $  terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -format=binary < tfplan.enc > tfplan \n\n" +
+
+			"   To decrypt a terraform.tfvars file encrypted using the tfvars format:\n\n" +
+
+			"        $  terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -format=tfvars -file=terraform.tfvars \n\n" +
+
+			"   To decrypt the data of each of the Kubernetes secrets within a YAML file encrypted using select:\n\n" +
+
+			"        $  terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -select='data.*' -file=secrets.yaml \n\n" +
+
 			"   To inline decrypt the previously saved output of a terraform plan using simple encryption:\n\n" +
 
 			"        $  cat plan-out.tfplan | terrahelp decrypt -simple-key=AES256Key-32Characters0987654321 -mode=inline\n\n" +
@@ -243,7 +343,7 @@ func decryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 			"        $  terrahelp decrypt -provider=vault vault-namedkey=my-vault-named-key -mode=inline -file=terraform.tfstate -file=terraform.tfstate.backup \n\n" +
 
 			"\n",
-		Flags: []cli.Flag{
+		Flags: concatFlags([]cli.Flag{
 			cli.StringFlag{
 				Name:        "provider",
 				Value:       terrahelp.ThEncryptProviderSimple,
@@ -255,9 +355,17 @@ func decryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 				Name:        "mode",
 				Value:       terrahelp.ThEncryptModeFull,
 				EnvVar:      "TH_ENCRYPTION_MODE",
-				Usage:       fmt.Sprintf("Encryption mode (inline|full) to use"),
+				Usage:       fmt.Sprintf("Encryption mode (inline|full|tfstate) to use"),
 				Destination: &ctxOpts.EncMode,
 			},
+			cli.StringFlag{
+				Name: "format",
+				Usage: "Format (tfvars|plan|binary) the content was encrypted in, instead of decrypting as per the mode, tfvars decrypts " +
+					"the encrypted string values of the tfvars file in place, keeping its variable names, structure, comments and formatting, " +
+					"plan decrypts each of the encrypted members of the terraform plan file (zip archive), and binary decrypts the content a " +
+					"chunk (line) at a time as it is read, restoring the original bytes",
+				Destination: &ctxOpts.Format,
+			},
 			cli.StringSliceFlag{
 				Name:  "file",
 				Usage: fmt.Sprintf("File(s) to encrypt - can be specified multiple times"),
@@ -286,12 +394,13 @@ func decryptCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Comman
 				Usage:       "(Vault provider only) Named encryption key to use",
 				Destination: &ctxOpts.NamedEncKey,
 			},
-		},
+		}, pathSelectFlags(ctxOpts)),
 		Action: func(c *cli.Context) {
 			th := f(ctxOpts.EncProvider)
 			err := ctxOpts.ValidateForEncryptDecrypt()
 			exitIfError(err)
 			setupTransformableItems(c, ctxOpts.TransformOpts, noBackup, bkpExt)
+			setupPathSelectors(c, ctxOpts)
 			err = th.Decrypt(ctxOpts)
 			exitIfError(err)
 		},
@@ -327,9 +436,10 @@ func vaultAutoConfigCommand(f func(provider string) *terrahelp.CryptoHandler) cl
 	}
 }
 
-func maskCommand() cli.Command {
+func maskCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Command {
 
-	ctxOpts := &terrahelp.MaskOpts{TransformOpts: &terrahelp.TransformOpts{}}
+	ctxOpts := &terrahelp.MaskOpts{TransformOpts: &terrahelp.TransformOpts{
+		Selection: &terrahelp.SelectionRules{}}}
 	var noBackup bool
 	var bkpExt string
 
@@ -340,6 +450,21 @@ func maskCommand() cli.Command {
 			"   data detected (by its presence in the terraform.tfvars file, i.e. the same mechanism used by \n" +
 			"   encrypt/decrypt) will be overwritten with the masked value. \n\n" +
 
+			"   Secrets which never appear in the terraform.tfvars file (e.g. provider generated AWS keys, PEM private \n" +
+			"   keys, JWTs, passwords within connection strings and GitHub tokens) can additionally be detected using \n" +
+			"   the built in detector rules by specifying the detect flag. Individual rules can be switched on or off \n" +
+			"   by their rule ID (aws-access-key-id, aws-secret-access-key, pem-private-key, jwt, \n" +
+			"   connection-string-password, github-token and the off by default high-entropy-string). \n\n" +
+
+			"   Organisation specific secrets can be detected with user defined rules, supplied via the rules-file flag \n" +
+			"   as either HCL or YAML. Each rule has an id, a regex and optionally the capture group holding the exact \n" +
+			"   secret, and (when masking) a replacement template to use instead of the mask, e.g. \n" +
+			"       rule \"azure-sas-signature\" {\n" +
+			"         regex       = \"sig=([A-Za-z0-9%]+)\"\n" +
+			"         capture     = 1\n" +
+			"         replacement = \"REDACTED\"\n" +
+			"       }\n\n" +
+
 			"   The typical use case for mask is with streamed or piped data (.e.g from terraform plan \n" +
 			"   or terraform apply). If the sensitive input values change from one run to another, quite often the output\n" +
 			"   from these functions will also include details of the changes including the previous (but\n" +
@@ -347,6 +472,10 @@ func maskCommand() cli.Command {
 			"   Specifically, if true (default is true), the function will try to detect common patterns typically \n" +
 			"   used by terraform commands to denote a sensitive input change, and additionally mask the previous value as well. \n\n" +
 
+			"   Piped data is masked, and written out line by line, as it is read (so long running commands such as \n" +
+			"   terraform apply show their progress) unless detector rules or the prev flag are in use, as the values \n" +
+			"   these find may have already appeared earlier in the output, so the whole output is first read in. \n\n" +
+
 			"   EXAMPLES \n" +
 			"   ----------- \n" +
 			"   To inline mask the output of a terraform plan (with default mask of ******):\n\n" +
@@ -359,35 +488,303 @@ func maskCommand() cli.Command {
 
 			"   To suppress the attempted detection of previous sensitive values when masking the output of a terraform plan:\n\n" +
 
-			"        $  terraform plan | terrahelp mask -prev=false \n\n",
+			"        $  terraform plan | terrahelp mask -prev=false \n\n" +
 
-		Flags: []cli.Flag{
+			"   To mask the output of a terraform plan using the secrets held in Vault KV (configured via the standard \n" +
+			"   Vault environment variables) rather than a local tfvars file:\n\n" +
+
+			"        $  terraform plan | terrahelp mask -vault-kv=secret/myapp/db -vault-kv=secret/myapp/api \n\n" +
+
+			"   To mask the output of a terraform plan using a (fully or inline) encrypted tfvars file, which is only\n" +
+			"   ever decrypted in memory:\n\n" +
+
+			"        $  terraform plan | terrahelp mask -provider=simple -simple-key=AES256Key-32Characters0987654321 \n\n" +
+
+			"   To mask the output of a terragrunt plan using the inputs of ./terragrunt.hcl (and any config it includes):\n\n" +
+
+			"        $  terragrunt plan | terrahelp mask \n\n" +
+
+			"   To additionally mask any rotated out secrets held in the tfvars backup file or its last 5 git revisions:\n\n" +
+
+			"        $  terraform plan | terrahelp mask -history -history-git=5 \n\n" +
+
+			"   To mask the output of a terraform plan such that the same secret is always masked the same way\n" +
+			"   (e.g. ******<a1b2c3>), using a keyed fingerprint of it:\n\n" +
+
+			"        $  terraform plan | terrahelp mask -mask-strategy=fingerprint -fingerprint-key=team-key \n\n" +
+
+			"   To mask the output of a terraform plan revealing which variable was masked (e.g. <sensitive:var.db_password>):\n\n" +
+
+			"        $  terraform plan | terrahelp mask -named \n\n" +
+
+			"   To tokenize the output of a terraform apply, writing the token mapping to apply.tokens (encrypted\n" +
+			"   with the simple provider) so it can later be restored using the unmask command:\n\n" +
+
+			"        $  terraform apply | terrahelp mask -tokenize -tokens=apply.tokens -provider=simple \\\n" +
+			"              -simple-key=AES256Key-32Characters0987654321 > apply.log \n\n" +
+
+			"   To fail a CI job should a terraform apply log about to be published contain any sensitive data,\n" +
+			"   recording what was found in report.json:\n\n" +
+
+			"        $  terrahelp mask -file=apply.log -fail-on-detect -report-file=report.json \n\n" +
+
+			"   To mask the output of a terraform plan removing, rather than preserving, its ANSI colours:\n\n" +
+
+			"        $  terraform plan | terrahelp mask -strip-colors \n\n" +
+
+			"   To mask the machine-readable output of a terraform plan, keeping each line valid JSON:\n\n" +
+
+			"        $  terraform plan -json | terrahelp mask -format=json \n\n" +
+
+			"   To produce a sanitised copy of a terraform plan file, with the sensitive values within its state,\n" +
+			"   variables and configuration masked (those within the binary plan masked to the same length):\n\n" +
+
+			"        $  terrahelp mask -format=plan < tfplan > tfplan.masked \n\n" +
+
+			"   To mask a terraform debug log, including the credentials within the provider HTTP requests and\n" +
+			"   responses (and their JSON bodies) and gRPC dumps logged, so it can be attached to a support ticket:\n\n" +
+
+			"        $  TF_LOG=DEBUG TF_LOG_PATH=debug.log terraform apply \n" +
+			"        $  terrahelp mask -log-mode -file=debug.log \n\n" +
+
+			"   To mask the output of a terraform apply, while archiving an encrypted copy of the unmasked output (written\n" +
+			"   as it is read, in the binary format, each 1MiB chunk encrypted by a single call to the provider, the rest once\n" +
+			"   the output ends), which can later be restored using 'decrypt -format=binary':\n\n" +
+
+			"        $  terraform apply | terrahelp mask -tee-encrypted=apply-{{timestamp}}.log.enc -provider=vault \n\n",
+
+		Flags: concatFlags([]cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "file",
+				Usage: "File(s) to have sensitive data replaced with mask - can be specified multiple times",
+			},
 			cli.StringFlag{
-				Name:        "maskchar",
-				Value:       terrahelp.MaskChar,
-				Usage:       "Forms mask pattern (numchars x maskchar) to replace sensitive data with",
-				Destination: &ctxOpts.MaskChar,
+				Name:        "bkpext",
+				Value:       terrahelp.ThBkpExtension,
+				Usage:       "Extension to use when creating backups",
+				Destination: &bkpExt,
 			},
-			cli.IntFlag{
-				Name:        "numchars",
-				Value:       terrahelp.NumberOfMaskChar,
-				Usage:       fmt.Sprintf("Forms mask pattern (numchars x maskchar) to replace sensitive data with"),
-				Destination: &ctxOpts.MaskNumChar,
+			cli.BoolFlag{
+				Name:        "nobackup",
+				Usage:       "Suppress the creation of backup files before masking (defaults to false)",
+				Destination: &noBackup,
 			},
-			cli.BoolTFlag{
-				Name:        "prev",
-				Usage:       "Include the attempted detection, and masking of previous sensitive values (defaults to true)",
-				Destination: &ctxOpts.ReplacePrevVals,
+		}, maskFlags(ctxOpts), selectionFlags(ctxOpts.Selection), sourceFlags(), detectFlags()),
+		Action: func(c *cli.Context) {
+			setupTransformableItems(c, ctxOpts.TransformOpts, noBackup, bkpExt)
+			err := newMasker(c, ctxOpts, f).Mask()
+			exitIfError(err)
+		},
+	}
+}
+
+// Flags used to configure how, and using which sensitive values, masking is performed
+func maskFlags(ctxOpts *terrahelp.MaskOpts) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "maskchar",
+			Value:       terrahelp.MaskChar,
+			Usage:       "Forms mask pattern (numchars x maskchar) to replace sensitive data with",
+			Destination: &ctxOpts.MaskChar,
+		},
+		cli.IntFlag{
+			Name:        "numchars",
+			Value:       terrahelp.NumberOfMaskChar,
+			Usage:       fmt.Sprintf("Forms mask pattern (numchars x maskchar) to replace sensitive data with"),
+			Destination: &ctxOpts.MaskNumChar,
+		},
+		cli.StringFlag{
+			Name:        "mask-strategy",
+			Value:       terrahelp.MaskStrategyFixed,
+			Usage:       "How sensitive values are masked (fixed|length|partial|fingerprint)",
+			Destination: &ctxOpts.MaskStrategy,
+		},
+		cli.IntFlag{
+			Name:        "reveal",
+			Value:       terrahelp.NumberOfRevealedChar,
+			Usage:       "(partial mask strategy only) the number of trailing characters of each sensitive value to reveal",
+			Destination: &ctxOpts.MaskReveal,
+		},
+		cli.StringFlag{
+			Name:        "fingerprint-key",
+			EnvVar:      "TH_FINGERPRINT_KEY",
+			Usage:       "(fingerprint mask strategy only) the key used to fingerprint sensitive values",
+			Destination: &ctxOpts.FingerprintKey,
+		},
+		cli.BoolFlag{
+			Name:        "named",
+			Usage:       "Render each mask with the mask template, revealing the variable (or detector rule) the masked value came from (defaults to false)",
+			Destination: &ctxOpts.NamedMasks,
+		},
+		cli.StringFlag{
+			Name:        "mask-template",
+			Value:       terrahelp.DefaultMaskTemplate,
+			Usage:       "(named masks only) template each mask is rendered with, {{name}} being replaced by the variable name and {{mask}} by the mask",
+			Destination: &ctxOpts.MaskTemplate,
+		},
+		cli.BoolFlag{
+			Name:        "tokenize",
+			Usage:       "Replace each sensitive value with a unique token, writing the token mapping (encrypted using the provider) so it can be unmasked (defaults to false)",
+			Destination: &ctxOpts.Tokenize,
+		},
+		cli.StringFlag{
+			Name:        "tokens",
+			Value:       terrahelp.DefaultTokenMapFilename,
+			Usage:       "(tokenize only) file the encrypted token mapping is written to",
+			Destination: &ctxOpts.TokenMapFilename,
+		},
+		cli.BoolFlag{
+			Name:        "report",
+			Usage:       "Write a summary of what was masked (counts and lines per source and variable, never the values) to stderr (defaults to false)",
+			Destination: &ctxOpts.Report,
+		},
+		cli.StringFlag{
+			Name:        "report-file",
+			Usage:       "File to write the summary of what was masked to, as JSON",
+			Destination: &ctxOpts.ReportFilename,
+		},
+		cli.BoolFlag{
+			Name: "fail-on-detect",
+			Usage: fmt.Sprintf("Exit with code %d, once masked, should any sensitive data have been found (defaults to false)",
+				sensitiveDataExitCode),
+			Destination: &ctxOpts.FailOnDetect,
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: terrahelp.MaskFormatText,
+			Usage: "How the content is treated (text|json|plan), json masking the string values within JSON documents or lines, keeping them valid JSON, " +
+				"and plan giving a sanitised copy of a terraform plan file, with the state, variables and configuration within it masked",
+			Destination: &ctxOpts.Format,
+		},
+		cli.BoolFlag{
+			Name:        "mask-keys",
+			Usage:       "(json format only) also mask sensitive values found within the keys of JSON objects (defaults to false)",
+			Destination: &ctxOpts.MaskKeys,
+		},
+		cli.BoolFlag{
+			Name: "log-mode",
+			Usage: "Mask terraform debug logs (TF_LOG), additionally detecting authorization headers and credential fields " +
+				"within the logged HTTP requests and responses, the JSON bodies (including those escaped within log fields and " +
+				"JSON log lines) and the JSON and msgpack encoded values of gRPC dumps, along with the encoded forms of all " +
+				"sensitive values (defaults to false)",
+			Destination: &ctxOpts.LogMode,
+		},
+		cli.StringFlag{
+			Name: "tee-encrypted",
+			Usage: "File to write a copy of the unmasked content to as it is read, encrypted using the provider in the binary format " +
+				"(a 1MiB chunk per line), " + terrahelp.TeeTimestamp + " being replaced by the current (UTC) time. With exec, the copy " +
+				"of stderr is written to the file suffixed with .stderr",
+			Destination: &ctxOpts.TeeEncryptedFilename,
+		},
+		cli.BoolTFlag{
+			Name:        "prev",
+			Usage:       "Include the attempted detection, and masking of previous sensitive values (defaults to true)",
+			Destination: &ctxOpts.ReplacePrevVals,
+		},
+		cli.StringFlag{
+			Name:        "dialect",
+			Value:       terrahelp.DialectAuto,
+			Usage:       "Terraform output dialect (auto|pre012|tf012|opentofu) whose patterns are used to detect previous sensitive values",
+			Destination: &ctxOpts.Dialect,
+		},
+		cli.BoolFlag{
+			Name:        "strip-colors",
+			Usage:       "Strip ANSI colour codes from the output rather than preserving them around masked values (defaults to false)",
+			Destination: &ctxOpts.StripColors,
+		},
+		cli.StringSliceFlag{
+			Name: "prev-pattern",
+			Usage: "Additional regex detecting previous sensitive values, held in its prev named (or first) capture group, " +
+				"{{mask}} within it matches a masked value - can be specified multiple times",
+		},
+		cli.StringFlag{
+			Name:        "tfvars",
+			Value:       terrahelp.TfvarsFilename,
+			Usage:       "Terraform tfvars filename, used to detect sensitive vals",
+			Destination: &ctxOpts.TfvarsFilename,
+		},
+		cli.StringFlag{
+			Name:        "provider",
+			Usage:       "Encryption provider (simple|vault|vault-cli) used to decrypt an encrypted tfvars file, and encrypt the token mapping or tee copy",
+			Destination: &ctxOpts.EncProvider,
+		},
+		cli.StringFlag{
+			Name:        "simple-key",
+			EnvVar:      "TH_SIMPLE_KEY",
+			Usage:       "(Simple provider only) the encryption key to use",
+			Destination: &ctxOpts.SimpleKey,
+		},
+		cli.StringFlag{
+			Name:        "vault-namedkey",
+			EnvVar:      "TH_VAULT_NAMED_KEY",
+			Value:       terrahelp.ThNamedEncryptionKey,
+			Usage:       "(Vault provider only) Named encryption key to use",
+			Destination: &ctxOpts.NamedEncKey,
+		},
+		cli.BoolTFlag{
+			Name:        "exclwhitespace",
+			Usage:       "Excludes the masking of whitespace only values (defaults to true)",
+			Destination: &ctxOpts.ExcludeWhitespaceOnly,
+		},
+		cli.BoolTFlag{
+			Name:        "encoded",
+			Usage:       "Includes the masking of base64, URL, JSON and HCL encoded forms of sensitive values (defaults to true)",
+			Destination: &ctxOpts.EncodedVariants,
+		},
+	}
+}
+
+// Sets up the Masker as per the mask flags
+func newMasker(c *cli.Context, ctxOpts *terrahelp.MaskOpts, f func(provider string) *terrahelp.CryptoHandler) *terrahelp.Masker {
+	setupSelectionRules(c, ctxOpts.Selection)
+	setupDetectors(c, ctxOpts.TransformOpts)
+	setupPrevPatterns(c, ctxOpts)
+	var e terrahelp.Encrypter
+	if ctxOpts.EncProvider != "" {
+		exitIfError(ctxOpts.ValidateForEncryptDecrypt())
+		e = f(ctxOpts.EncProvider).Encrypter
+	}
+	return terrahelp.NewMasker(ctxOpts, sensitiveReplaceables(c, ctxOpts.TransformOpts,
+		ctxOpts.ExcludeWhitespaceOnly, e, ctxOpts.EncryptionKey())).WithEncryption(e, ctxOpts.EncryptionKey())
+}
+
+func unmaskCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Command {
+
+	var noBackup bool
+	var bkpExt string
+	ctxOpts := terrahelp.NewDefaultUnmaskOpts()
+
+	return cli.Command{
+		Name:  "unmask",
+		Usage: "Restores content tokenized by mask -tokenize back to its original form",
+		Description: "Unmask replaces each token within content previously tokenized by 'mask -tokenize' with the sensitive \n" +
+			"   value it stands for, as held in the (encrypted) token mapping written at the time. The same 'provider'\n" +
+			"   and key used when tokenizing must be supplied to decrypt the token mapping. Terrahelp always assumes\n" +
+			"   you are piping your content in (for example from stdin) unless you explicitly specify file(s) to read in\n" +
+			"   from (and thus also write out to).\n\n" +
+
+			"   To restore a tokenized apply log:\n\n" +
+
+			"        $  terrahelp unmask -tokens=apply.tokens -simple-key=AES256Key-32Characters0987654321 \\\n" +
+			"              < apply.log > apply-original.log \n\n",
+
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "tokens",
+				Value:       terrahelp.DefaultTokenMapFilename,
+				Usage:       "File holding the encrypted token mapping written when tokenizing",
+				Destination: &ctxOpts.TokenMapFilename,
+			},
+			cli.StringFlag{
+				Name:        "provider",
+				Value:       terrahelp.ThEncryptProviderSimple,
+				EnvVar:      "TH_ENCRYPTION_PROVIDER",
+				Usage:       "Encryption provider (simple|vault|vault-cli) used to decrypt the token mapping",
+				Destination: &ctxOpts.EncProvider,
 			},
 			cli.StringSliceFlag{
 				Name:  "file",
-				Usage: "File(s) to have sensitive data replaced with mask - can be specified multiple times",
-			},
-			cli.StringFlag{
-				Name:        "tfvars",
-				Value:       terrahelp.TfvarsFilename,
-				Usage:       "Terraform tfvars filename, used to detect sensitive vals",
-				Destination: &ctxOpts.TfvarsFilename,
+				Usage: "File(s) to unmask - can be specified multiple times",
 			},
 			cli.StringFlag{
 				Name:        "bkpext",
@@ -397,28 +794,170 @@ func maskCommand() cli.Command {
 			},
 			cli.BoolFlag{
 				Name:        "nobackup",
-				Usage:       "Suppress the creation of backup files before masking (defaults to false)",
+				Usage:       "Suppress the creation of backup files before unmasking (defaults to false)",
 				Destination: &noBackup,
 			},
-			cli.BoolTFlag{
-				Name:        "exclwhitespace",
-				Usage:       "Excludes the masking of whitespace only values (defaults to true)",
-				Destination: &ctxOpts.ExcludeWhitespaceOnly,
+			cli.StringFlag{
+				Name:        "simple-key",
+				EnvVar:      "TH_SIMPLE_KEY",
+				Usage:       "(Simple provider only) the encryption key to use",
+				Destination: &ctxOpts.SimpleKey,
+			},
+			cli.StringFlag{
+				Name:        "vault-namedkey",
+				Value:       terrahelp.ThNamedEncryptionKey,
+				EnvVar:      "TH_VAULT_NAMED_KEY",
+				Usage:       "(Vault provider only) Named encryption key to use",
+				Destination: &ctxOpts.NamedEncKey,
+			},
+			cli.BoolFlag{
+				Name:        "debug",
+				Usage:       "Logs (to stderr) any tokens not found in the token mapping (defaults to false)",
+				Destination: &ctxOpts.Debug,
 			},
 		},
 		Action: func(c *cli.Context) {
+			th := f(ctxOpts.EncProvider)
+			exitIfError(ctxOpts.ValidateForEncryptDecrypt())
 			setupTransformableItems(c, ctxOpts.TransformOpts, noBackup, bkpExt)
-			m := terrahelp.NewMasker(ctxOpts, terrahelp.NewTfVars(ctxOpts.TfvarsFilename, ctxOpts.ExcludeWhitespaceOnly))
-			err := m.Mask()
+			err := terrahelp.NewUnmasker(ctxOpts, th.Encrypter).Unmask()
 			exitIfError(err)
 		},
 	}
 }
 
+func execCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Command {
+
+	ctxOpts := &terrahelp.MaskOpts{TransformOpts: &terrahelp.TransformOpts{
+		Selection: &terrahelp.SelectionRules{}}}
+
+	return cli.Command{
+		Name:      "exec",
+		Usage:     "Runs a command (e.g. terraform apply) under a pseudo-terminal, masking its output as it is written",
+		ArgsUsage: "[mask options] -- command [arguments...]",
+		Description: "Exec runs the command under a pseudo-terminal, so it behaves exactly as it would when run directly\n" +
+			"   (i.e. keeping its colours and interactive approval prompts), while masking both its stdout and stderr\n" +
+			"   as they are written, using the same options as the mask command. Input, and signals, are forwarded to\n" +
+			"   the command, and terrahelp exits with its exit status. Previous values, and any detected values, are\n" +
+			"   found within each part of the output as it is written, rather than the output as a whole.\n\n" +
+
+			"   To apply a terraform plan, answering its approval prompt, with its output masked:\n\n" +
+
+			"        $  terrahelp exec -- terraform apply \n\n" +
+
+			"   To do so in CI, archiving an encrypted copy of the unmasked output for audit purposes (stdout to\n" +
+			"   apply-<time>.log.enc and stderr to apply-<time>.log.enc.stderr):\n\n" +
+
+			"        $  terrahelp exec -tee-encrypted=apply-{{timestamp}}.log.enc -provider=vault -- terraform apply -auto-approve \n\n" +
+
+			"   Note: exec is not supported on windows.\n\n",
+
+		Flags: concatFlags(maskFlags(ctxOpts), selectionFlags(ctxOpts.Selection), sourceFlags(), detectFlags()),
+		Action: func(c *cli.Context) {
+			args := c.Args()
+			if len(args) == 0 {
+				exitIfError(fmt.Errorf("No command specified to exec"))
+			}
+			code, err := terrahelp.NewExecutor(newMasker(c, ctxOpts, f)).Run(args[0], args[1:]...)
+			if err != nil && err != terrahelp.ErrSensitiveDataMasked {
+				exitIfError(err)
+			}
+			if code != 0 {
+				os.Exit(code)
+			}
+			exitIfError(err)
+		},
+	}
+}
+
+func sensitiveValuesCommand(f func(provider string) *terrahelp.CryptoHandler) cli.Command {
+
+	var tfvarsFilename string
+	var exclWhitespace bool
+	rules := &terrahelp.SelectionRules{}
+	provOpts := &terrahelp.ProviderOpts{}
+
+	return cli.Command{
+		Name:  "sensitive-values",
+		Usage: "Lists the tfvars variables whose values would be treated as sensitive.",
+		Description: "Applies the same selection rules used by mask and inline encrypt to the terraform.tfvars file and \n" +
+			"   lists the names of the variables which would be considered sensitive. Only variable names are ever \n" +
+			"   printed, never their values. By default every non empty string value is considered sensitive, except \n" +
+			"   values which are obviously not secrets such as booleans, numbers, region names, IPs and CIDRs (unless \n" +
+			"   -skip-nonsecret=false). This can be narrowed down by variable name (include-vars / exclude-vars \n" +
+			"   globs) or by a minimum value length. An encrypted tfvars file is decrypted (in memory only) using the \n" +
+			"   encryption provider. \n\n" +
+
+			"   EXAMPLES \n" +
+			"   ----------- \n" +
+			"   To list the variables selected when only password and token variables are considered sensitive:\n\n" +
+
+			"        $  terrahelp sensitive-values -include-vars=*_password -include-vars=*_token\n\n" +
+
+			"   To list the variables selected when skipping values shorter than 8 characters, but not obvious non secrets:\n\n" +
+
+			"        $  terrahelp sensitive-values -skip-nonsecret=false -min-length=8 \n\n" +
+
+			"   To list the variables selected within a tfvars file encrypted using the simple provider:\n\n" +
+
+			"        $  terrahelp sensitive-values -provider=simple -simple-key=$KEY \n\n",
+
+		Flags: concatFlags([]cli.Flag{
+			cli.StringFlag{
+				Name:        "tfvars",
+				Value:       terrahelp.TfvarsFilename,
+				Usage:       "Terraform tfvars filename, used to detect sensitive vals",
+				Destination: &tfvarsFilename,
+			},
+			cli.BoolTFlag{
+				Name:        "exclwhitespace",
+				Usage:       "Excludes whitespace only values (defaults to true)",
+				Destination: &exclWhitespace,
+			},
+			cli.StringFlag{
+				Name:        "provider",
+				Usage:       "Encryption provider (simple|vault|vault-cli) used to decrypt an encrypted tfvars file",
+				Destination: &provOpts.EncProvider,
+			},
+			cli.StringFlag{
+				Name:        "simple-key",
+				EnvVar:      "TH_SIMPLE_KEY",
+				Usage:       "(Simple provider only) the encryption key to use",
+				Destination: &provOpts.SimpleKey,
+			},
+			cli.StringFlag{
+				Name:        "vault-namedkey",
+				EnvVar:      "TH_VAULT_NAMED_KEY",
+				Value:       terrahelp.ThNamedEncryptionKey,
+				Usage:       "(Vault provider only) Named encryption key to use",
+				Destination: &provOpts.NamedEncKey,
+			},
+		}, selectionFlags(rules)),
+		Action: func(c *cli.Context) {
+			setupSelectionRules(c, rules)
+			var e terrahelp.Encrypter
+			if provOpts.EncProvider != "" {
+				exitIfError(provOpts.ValidateForEncryptDecrypt())
+				e = f(provOpts.EncProvider).Encrypter
+			}
+			names, err := newTfVars(tfvarsFilename, exclWhitespace, rules, e, provOpts.EncryptionKey()).SelectedVariables()
+			exitIfError(err)
+			for _, n := range names {
+				fmt.Println(n)
+			}
+		},
+	}
+}
+
 // At present code required to add decent exit code support in the cli library
 // is awaiting a 2.0. release (https://github.com/codegangsta/cli/pull/266)
 // so until then we have to do a bit of an ugly emergency exit ourselves
 func exitIfError(e error) {
+	if e == terrahelp.ErrSensitiveDataMasked {
+		// The (masked) output may well be stdout
+		fmt.Fprintf(os.Stderr, "%s\n", e)
+		os.Exit(sensitiveDataExitCode)
+	}
 	if e != nil {
 		fmt.Printf("ERROR occurred : %s\n", e)
 		switch e.(type) {
@@ -449,3 +988,243 @@ func setupTransformableItems(c *cli.Context,
 			terrahelp.NewFileTransformable(f, !noBackup, bkpExt))
 	}
 }
+
+// Flags used to select, by their path, the values to encrypt or
+// decrypt within a JSON, YAML or HCL document
+func pathSelectFlags(ctxOpts *terrahelp.CryptoHandlerOpts) []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name: "select",
+			Usage: "Path (e.g. outputs.*.value or resources[type=aws_db_instance].instances[*].attributes.password) of the " +
+				"values within a JSON, YAML or HCL document to encrypt in full, instead of as per the mode - can be specified multiple times",
+		},
+		cli.StringFlag{
+			Name:        "doc-format",
+			Value:       terrahelp.DocFormatAuto,
+			Usage:       "(select only) Format (auto|json|yaml|hcl) of the document, auto using the file extension, or failing that the content",
+			Destination: &ctxOpts.DocFormat,
+		},
+	}
+}
+
+// Sets up the path selectors (if any) from the command line
+func setupPathSelectors(c *cli.Context, ctxOpts *terrahelp.CryptoHandlerOpts) {
+	for _, p := range c.StringSlice("select") {
+		s, err := terrahelp.ParsePathSelector(p)
+		exitIfError(err)
+		ctxOpts.Selectors = append(ctxOpts.Selectors, s)
+	}
+}
+
+// Flags used to configure the rules which select which tfvars
+// values are considered to be sensitive
+func selectionFlags(r *terrahelp.SelectionRules) []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "include-vars",
+			Usage: "Only treat variables matching the glob (e.g. *_password) as sensitive - can be specified multiple times",
+		},
+		cli.StringSliceFlag{
+			Name:  "exclude-vars",
+			Usage: "Never treat variables matching the glob as sensitive - can be specified multiple times",
+		},
+		cli.IntFlag{
+			Name:        "min-length",
+			Usage:       "Minimum length a value must have to be treated as sensitive",
+			Destination: &r.MinLength,
+		},
+		cli.BoolTFlag{
+			Name:        "skip-nonsecret",
+			Usage:       "Skip obviously non secret values such as booleans, numbers, region names and CIDRs (defaults to true)",
+			Destination: &r.SkipNonSecret,
+		},
+	}
+}
+
+// Sets up the variable name globs of the SelectionRules from
+// the command line
+func setupSelectionRules(c *cli.Context, r *terrahelp.SelectionRules) {
+	r.IncludeVars = c.StringSlice("include-vars")
+	r.ExcludeVars = c.StringSlice("exclude-vars")
+}
+
+// Flags used to configure the built in detection of sensitive values
+// which are not otherwise known up front
+func detectFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "detect",
+			Usage: "Additionally detect secrets (AWS keys, private keys, JWTs etc) using the built in detector rules (defaults to false)",
+		},
+		cli.StringSliceFlag{
+			Name:  "detect-enable",
+			Usage: "Enable the built in detector rule with this ID, implies -detect - can be specified multiple times",
+		},
+		cli.StringSliceFlag{
+			Name:  "detect-disable",
+			Usage: "Disable the built in detector rule with this ID - can be specified multiple times",
+		},
+		cli.StringSliceFlag{
+			Name:  "rules-file",
+			Usage: "HCL, JSON or YAML file of user defined rules used to detect secrets - can be specified multiple times",
+		},
+	}
+}
+
+// Sets up the detectors to use (if any) from the command line
+func setupDetectors(c *cli.Context, ctxOpts *terrahelp.TransformOpts) {
+	enable := c.StringSlice("detect-enable")
+	if c.Bool("detect") || len(enable) > 0 {
+		d, err := terrahelp.NewDefaultRuleDetector(enable, c.StringSlice("detect-disable"))
+		exitIfError(err)
+		ctxOpts.Detectors = append(ctxOpts.Detectors, d)
+	}
+	for _, f := range c.StringSlice("rules-file") {
+		rules, err := terrahelp.LoadDetectorRulesFile(f)
+		exitIfError(err)
+		ctxOpts.Detectors = append(ctxOpts.Detectors, terrahelp.NewRuleDetector(rules))
+	}
+}
+
+// Sets up the output dialect and user defined previous value patterns
+func setupPrevPatterns(c *cli.Context, ctxOpts *terrahelp.MaskOpts) {
+	_, err := terrahelp.LookupOutputDialect(ctxOpts.Dialect)
+	exitIfError(err)
+	for i, p := range c.StringSlice("prev-pattern") {
+		pp := &terrahelp.PrevValuePattern{ID: fmt.Sprintf("prev-pattern-%d", i+1), Pattern: p}
+		exitIfError(terrahelp.ValidatePrevValuePattern(pp))
+		ctxOpts.PrevPatterns = append(ctxOpts.PrevPatterns, pp)
+	}
+}
+
+// Flags used to configure the sources of sensitive values, in addition
+// to the tfvars file
+func sourceFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "extra-tfvars",
+			Usage: "Additional tfvars file whose values are sensitive - can be specified multiple times",
+		},
+		cli.BoolFlag{
+			Name:  "env-vars",
+			Usage: "Treat the values of TF_VAR_ environment variables as sensitive (defaults to false)",
+		},
+		cli.StringSliceFlag{
+			Name: "terragrunt",
+			Usage: "Terragrunt config file (including any it includes) whose inputs are sensitive - can be specified multiple times, " +
+				"defaults to ./" + terrahelp.DefaultTerragruntFilename + " if present and the tfvars file is not",
+		},
+		cli.StringSliceFlag{
+			Name:  "tfstate-outputs",
+			Usage: "Tfstate file whose sensitive output values are sensitive - can be specified multiple times",
+		},
+		cli.StringSliceFlag{
+			Name:  "vault-kv",
+			Usage: "Vault KV (v1 or v2) path whose values are sensitive - can be specified multiple times",
+		},
+		cli.BoolFlag{
+			Name:  "history",
+			Usage: "Treat the previous values held in the tfvars backup (" + terrahelp.ThBkpExtension + ") files, and in the earlier (possibly encrypted) serials of the tfstate files (terraform.tfstate and any -tfstate-outputs) i.e. their .backup and " + terrahelp.ThBkpExtension + " files, as sensitive (defaults to false)",
+		},
+		cli.IntFlag{
+			Name:  "history-git",
+			Usage: "Treat the values held in the last N git revisions of the tfvars files as sensitive",
+		},
+		cli.StringSliceFlag{
+			Name:  "history-tfstate",
+			Usage: "Earlier (e.g. backup) tfstate file whose sensitive output and resource attribute values are sensitive - can be specified multiple times (terraform only records which resource attributes are sensitive from 0.15)",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Log (to stderr) how many occurrences of each sensitive value were replaced, and where it came from",
+		},
+	}
+}
+
+// Creates the Replaceables merging all the sources of sensitive values requested
+// via the command line, in order of precedence: tfvars files, terragrunt inputs,
+// TF_VAR_ environment variables, sensitive tfstate outputs, Vault KV secrets and
+// finally the previous values held in backups and git history.
+// The tfvars file is optional when other sources are specified and it was not
+// explicitly set, should neither it nor the -terragrunt option be set, a
+// terragrunt config file in the current directory is used in its place.
+// If an Encrypter is supplied, encrypted tfvars and tfstate files are decrypted with it.
+func sensitiveReplaceables(c *cli.Context, ctxOpts *terrahelp.TransformOpts, excl bool,
+	e terrahelp.Encrypter, key string) terrahelp.Replaceables {
+	ctxOpts.Debug = c.Bool("debug")
+
+	var tfvars []*terrahelp.Tfvars
+	var others []terrahelp.Replaceables
+	for _, f := range c.StringSlice("extra-tfvars") {
+		tfvars = append(tfvars, newTfVars(f, excl, ctxOpts.Selection, e, key))
+	}
+	for _, f := range c.StringSlice("terragrunt") {
+		others = append(others, terrahelp.NewTerragruntReplaceables(f, excl, ctxOpts.Selection))
+	}
+	if c.Bool("env-vars") {
+		others = append(others, terrahelp.NewEnvReplaceables(excl, ctxOpts.Selection))
+	}
+	for _, f := range c.StringSlice("tfstate-outputs") {
+		others = append(others, terrahelp.NewTfstateOutputsReplaceables(f).WithDecryption(e, key))
+	}
+	if paths := c.StringSlice("vault-kv"); len(paths) > 0 {
+		vc, err := terrahelp.NewDefaultVaultClient()
+		exitIfError(err)
+		others = append(others, terrahelp.NewVaultKVReplaceables(vc, paths))
+	}
+
+	if _, err := os.Stat(ctxOpts.TfvarsFilename); err == nil || c.IsSet("tfvars") {
+		tfvars = append([]*terrahelp.Tfvars{newTfVars(ctxOpts.TfvarsFilename, excl, ctxOpts.Selection, e, key)}, tfvars...)
+	} else if _, err := os.Stat(terrahelp.DefaultTerragruntFilename); err == nil && !c.IsSet("terragrunt") {
+		others = append([]terrahelp.Replaceables{
+			terrahelp.NewTerragruntReplaceables(terrahelp.DefaultTerragruntFilename, excl, ctxOpts.Selection)}, others...)
+	} else if len(tfvars) == 0 && len(others) == 0 {
+		tfvars = append(tfvars, newTfVars(ctxOpts.TfvarsFilename, excl, ctxOpts.Selection, e, key))
+	}
+
+	// Previous values come last, so values still in use are
+	// recorded as coming from their current source
+	var history []terrahelp.Replaceables
+	if c.Bool("history") || c.Int("history-git") > 0 {
+		bkpExt := ""
+		if c.Bool("history") {
+			bkpExt = terrahelp.ThBkpExtension
+		}
+		for _, t := range tfvars {
+			history = append(history, terrahelp.NewTfvarsHistory(t, bkpExt, c.Int("history-git")))
+		}
+	}
+	if c.Bool("history") {
+		states := append([]string{terrahelp.TfstateFilename}, c.StringSlice("tfstate-outputs")...)
+		for _, f := range states {
+			history = append(history, terrahelp.NewTfstateHistory(f, terrahelp.ThBkpExtension).WithDecryption(e, key))
+		}
+	}
+	for _, f := range c.StringSlice("history-tfstate") {
+		history = append(history, terrahelp.NewTfstateOutputsReplaceables(f).WithDecryption(e, key).WithSensitiveAttributes())
+	}
+
+	var sources []terrahelp.Replaceables
+	for _, t := range tfvars {
+		sources = append(sources, t)
+	}
+	sources = append(append(sources, others...), history...)
+	return terrahelp.NewCompositeReplaceables(sources...)
+}
+
+func newTfVars(f string, excl bool, r *terrahelp.SelectionRules, e terrahelp.Encrypter, key string) *terrahelp.Tfvars {
+	tfv := terrahelp.NewTfVarsWithSelection(f, excl, r)
+	if e != nil {
+		tfv.WithDecryption(e, key)
+	}
+	return tfv
+}
+
+// Concatenates the sets of flags supported by a command
+func concatFlags(sets ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, s := range sets {
+		flags = append(flags, s...)
+	}
+	return flags
+}
@@ -19,7 +19,10 @@ func main() {
 		vaultAutoConfigCommand(newTerraHelperFunc()),
 		encryptCommand(newTerraHelperFunc()),
 		decryptCommand(newTerraHelperFunc()),
-		maskCommand(),
+		maskCommand(newTerraHelperFunc()),
+		unmaskCommand(newTerraHelperFunc()),
+		execCommand(newTerraHelperFunc()),
+		sensitiveValuesCommand(newTerraHelperFunc()),
 	}
 	app.Run(os.Args)
 }
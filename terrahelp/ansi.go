@@ -0,0 +1,103 @@
+package terrahelp
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiEscapeRegExp matches ANSI escape sequences (as stripped by stripansi)
+var ansiEscapeRegExp = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
+
+// ansiEscape is an ANSI escape sequence, found before the
+// visible character at pos
+type ansiEscape struct {
+	pos int
+	seq string
+}
+
+// splitANSI splits the content into its visible text and the ANSI escape
+// sequences within it, along with the offset within the content of
+// each visible character
+func splitANSI(s string) (string, []ansiEscape, []int) {
+	locs := ansiEscapeRegExp.FindAllStringIndex(s, -1)
+	if len(locs) == 0 {
+		return s, nil, nil
+	}
+	var vis strings.Builder
+	var escs []ansiEscape
+	offsets := make([]int, 0, len(s))
+	last := 0
+	for _, l := range locs {
+		for i := last; i < l[0]; i++ {
+			offsets = append(offsets, i)
+		}
+		vis.WriteString(s[last:l[0]])
+		escs = append(escs, ansiEscape{pos: vis.Len(), seq: s[l[0]:l[1]]})
+		last = l[1]
+	}
+	for i := last; i < len(s); i++ {
+		offsets = append(offsets, i)
+	}
+	vis.WriteString(s[last:])
+	return vis.String(), escs, offsets
+}
+
+// ansiReplace replaces the occurrences of the values (matched against the visible
+// text, so regardless of any ANSI escape sequences within them) within the content,
+// keeping the escape sequences. Those found within an occurrence are written out
+// after its replacement, so the colours of the text which follows are unchanged.
+func ansiReplace(r *Replacer, s string, f func(m replacerMatch) (string, error)) (string, error) {
+	out, _, err := ansiReplacePrefix(r, s, true, f)
+	return out, err
+}
+
+// ansiReplacePrefix is the escape sequence aware equivalent of Replacer.replacePrefix,
+// with the occurrences provided to f being within the visible text
+func ansiReplacePrefix(r *Replacer, s string, final bool, f func(m replacerMatch) (string, error)) (string, string, error) {
+	vis, escs, offsets := splitANSI(s)
+	if escs == nil {
+		return r.replacePrefix(s, final, f)
+	}
+	matches, consumed := r.prefixMatches(vis, final)
+
+	// Any escape sequences before the first unconsumed visible character are carried over
+	end := len(s)
+	if consumed < len(vis) {
+		end = 0
+		if consumed > 0 {
+			end = offsets[consumed-1] + 1
+		}
+	}
+
+	var sb strings.Builder
+	e := 0
+	// writeText writes the visible text from a up to b, along with the escape sequences before
+	// each character, including those after the last should inclusive be set
+	writeText := func(a, b int, inclusive bool) {
+		for i := a; i <= b; i++ {
+			for e < len(escs) && escs[e].pos == i && (i < b || inclusive) {
+				sb.WriteString(escs[e].seq)
+				e++
+			}
+			if i < b {
+				sb.WriteByte(vis[i])
+			}
+		}
+	}
+	last := 0
+	for _, m := range matches {
+		writeText(last, m.start, true)
+		rep, err := f(m)
+		if err != nil {
+			return "", "", err
+		}
+		sb.WriteString(rep)
+		for e < len(escs) && escs[e].pos < m.end {
+			sb.WriteString(escs[e].seq)
+			e++
+		}
+		last = m.end
+	}
+	writeText(last, consumed, consumed == len(vis))
+	return sb.String(), s[end:], nil
+}
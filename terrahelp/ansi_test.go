@@ -0,0 +1,90 @@
+package terrahelp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitANSI(t *testing.T) {
+	vis, escs, offsets := splitANSI("a\x1b[1mbc\x1b[0m")
+
+	assert.Equal(t, "abc", vis)
+	assert.Equal(t, []ansiEscape{{pos: 1, seq: "\x1b[1m"}, {pos: 3, seq: "\x1b[0m"}}, escs)
+	assert.Equal(t, []int{0, 5, 6}, offsets)
+}
+
+func TestMasker_maskBytes_PreservesANSIColours(t *testing.T) {
+	scenarios := map[string]string{
+		// Colours around the secret are kept
+		"\x1b[32m+\x1b[0m \"msg1\" = \"\x1b[1msensitive-value-1\x1b[0m\"": "\x1b[32m+\x1b[0m \"msg1\" = \"\x1b[1m******\x1b[0m\"",
+		// Colours within the secret follow the mask
+		"key = \"sensitive-\x1b[31mvalue-1\x1b[0m\" done": "key = \"******\x1b[31m\x1b[0m\" done",
+		// No secret, nothing changes
+		"\x1b[1mplain\x1b[0m text": "\x1b[1mplain\x1b[0m text",
+	}
+	for in, expected := range scenarios {
+		// Given
+		ctx := NewDefaultMaskOpts()
+		m := NewMasker(ctx, &DefaultReplaceables{[]string{"sensitive-value-1"}})
+
+		// When
+		actual, err := m.maskBytes([]byte(in))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual), "%q", in)
+	}
+}
+
+func TestMasker_maskBytes_PreservesANSIColoursPrevValue(t *testing.T) {
+	// Given a coloured terraform 0.12 change of a sensitive value
+	ctx := NewDefaultMaskOpts()
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{"new-secret-SKDJH"}})
+
+	// When
+	actual, err := m.maskBytes([]byte("\x1b[33m~\x1b[0m \x1b[0m\x1b[1m\x1b[0mpassword\x1b[0m\x1b[0m = \"old-secret-DJSKH\" \x1b[33m->\x1b[0m\x1b[0m \"new-secret-SKDJH\"\n"))
+
+	// Then both the previous and current values are masked, keeping the colours
+	assert.NoError(t, err)
+	assert.Equal(t, "\x1b[33m~\x1b[0m \x1b[0m\x1b[1m\x1b[0mpassword\x1b[0m\x1b[0m = \"******\" \x1b[33m->\x1b[0m\x1b[0m \"******\"\n", string(actual))
+}
+
+func TestMasker_maskBytes_StripColors(t *testing.T) {
+	// Given
+	ctx := NewDefaultMaskOpts()
+	ctx.StripColors = true
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{"sensitive-value-1"}})
+
+	// When
+	actual, err := m.maskBytes([]byte("\x1b[1mkey\x1b[0m = \"sensitive-\x1b[31mvalue-1\x1b[0m\""))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "key = \"******\"", string(actual))
+}
+
+func TestMasker_maskStream_PreservesANSIColours(t *testing.T) {
+	// Given content with colour codes within, and around, sensitive values
+	b, err := ioutil.ReadFile("test-data/ansi-escape-codes/console_output.txt")
+	assert.NoError(t, err)
+	content := string(b) + "\n\x1b[1mkey\x1b[0m = \"sensitive-\x1b[31mvalue-1\x1b[0m-AK#%DJGHS*G\"\n"
+	ctx := NewDefaultMaskOpts()
+	ctx.ReplacePrevVals = false
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{"sensitive-value-1-AK#%DJGHS*G", "madeup-aws-secret-key-KGSDGH"}})
+	expected, err := m.maskBytes([]byte(content))
+	assert.NoError(t, err)
+
+	// When the content is streamed one byte at a time
+	var out bytes.Buffer
+	err = m.maskStream(iotest.OneByteReader(strings.NewReader(content)), &out)
+
+	// Then the result is identical to masking it all at once
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), out.String())
+	assert.Contains(t, out.String(), "key\x1b[0m = \"******\x1b[31m\x1b[0m\"")
+}
@@ -0,0 +1,121 @@
+package terrahelp
+
+import (
+	"sort"
+)
+
+// SourcedValue is a sensitive value along with the details of
+// where (which source, and which variable) it came from
+type SourcedValue struct {
+	Value    string
+	Source   string
+	Variable string
+
+	// replacement if set, is used in place of the mask when masking the value
+	replacement string
+}
+
+// Name returns the name best describing where the value came from,
+// i.e. the variable if known, otherwise the source
+func (v SourcedValue) Name() string {
+	if v.Variable != "" {
+		return v.Variable
+	}
+	return v.Source
+}
+
+// SourcedReplaceables defines Replaceables which are additionally
+// able to record which source and variable each value came from
+type SourcedReplaceables interface {
+	Replaceables
+
+	// SourcedValues returns the list of values to replace, along
+	// with where they came from, or an error
+	SourcedValues() ([]SourcedValue, error)
+}
+
+// Source used for values obtained from a Replaceables which is
+// unable to record where its values came from
+const unknownValueSource = "values"
+
+// CompositeReplaceables merges the values of several Replaceables
+// (e.g. tfvars files, environment, tfstate, Vault KV) into one
+type CompositeReplaceables struct {
+	sources []Replaceables
+}
+
+// NewCompositeReplaceables creates a new CompositeReplaceables, the sources
+// are supplied in order of precedence, so should the same value be provided
+// by more than one source it is recorded as coming from the first
+func NewCompositeReplaceables(sources ...Replaceables) *CompositeReplaceables {
+	return &CompositeReplaceables{sources: sources}
+}
+
+// Values returns the de-duplicated values of all the sources, ordered
+// longest first so that overlapping values are replaced safely
+func (c *CompositeReplaceables) Values() ([]string, error) {
+	svs, err := c.SourcedValues()
+	if err != nil {
+		return nil, err
+	}
+	return values(svs), nil
+}
+
+// SourcedValues returns the de-duplicated values of all the sources along
+// with where they came from, ordered longest first
+func (c *CompositeReplaceables) SourcedValues() ([]SourcedValue, error) {
+	var all []SourcedValue
+	for _, s := range c.sources {
+		svs, err := sourcedValues(s)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, svs...)
+	}
+	return orderSourcedValues(all), nil
+}
+
+// sourcedValues returns the values of the Replaceables along with
+// where they came from, should it be able to record this
+func sourcedValues(r Replaceables) ([]SourcedValue, error) {
+	if sr, ok := r.(SourcedReplaceables); ok {
+		return sr.SourcedValues()
+	}
+	vals, err := r.Values()
+	if err != nil {
+		return nil, err
+	}
+	svs := make([]SourcedValue, 0, len(vals))
+	for _, v := range vals {
+		svs = append(svs, SourcedValue{Value: v, Source: unknownValueSource})
+	}
+	return svs, nil
+}
+
+// orderSourcedValues removes any duplicate values (keeping the first), ordering
+// the result longest first so that overlapping values are replaced safely
+func orderSourcedValues(svs []SourcedValue) []SourcedValue {
+	seen := map[string]bool{}
+	var ordered []SourcedValue
+	for _, sv := range svs {
+		if !seen[sv.Value] {
+			seen[sv.Value] = true
+			ordered = append(ordered, sv)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if len(ordered[i].Value) != len(ordered[j].Value) {
+			return len(ordered[i].Value) > len(ordered[j].Value)
+		}
+		return ordered[i].Value > ordered[j].Value
+	})
+	return ordered
+}
+
+func values(svs []SourcedValue) []string {
+	vals := make([]string, 0, len(svs))
+	for _, sv := range svs {
+		vals = append(vals, sv.Value)
+	}
+	return vals
+}
@@ -0,0 +1,65 @@
+package terrahelp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testReplaceables []string
+
+func (r testReplaceables) Values() ([]string, error) {
+	return r, nil
+}
+
+func TestCompositeReplaceables_SourcedValues(t *testing.T) {
+	// Given
+	env := NewEnvReplaceables(true, nil)
+	env.environ = func() []string {
+		return []string{"TF_VAR_db_password=db-password-HDKSJ", "TF_VAR_api_token=api-token-SDJKHS"}
+	}
+	c := NewCompositeReplaceables(
+		NewTfstateOutputsReplaceables("test-data/sources/terraform.tfstate"),
+		env,
+		testReplaceables{"plain-value-SKDJ", "api-token-SDJKHS"})
+
+	// When
+	svs, err := c.SourcedValues()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "api-key-primary-JSDK", Source: "tfstate:test-data/sources/terraform.tfstate", Variable: "output.api_keys.primary"},
+		{Value: "api-key-other-KSJD", Source: "tfstate:test-data/sources/terraform.tfstate", Variable: "output.api_keys.others[0]"},
+		{Value: "db-password-HDKSJ", Source: "tfstate:test-data/sources/terraform.tfstate", Variable: "output.db_password"},
+		{Value: "plain-value-SKDJ", Source: unknownValueSource},
+		{Value: "api-token-SDJKHS", Source: "env", Variable: "var.api_token"},
+	}, svs)
+}
+
+func TestCompositeReplaceables_Values(t *testing.T) {
+	// Given
+	c := NewCompositeReplaceables(
+		NewTfVars("test-data/selection/terraform.tfvars", true),
+		testReplaceables{"a-much-longer-value-than-any-other-SKDJHFKSJDHF"})
+
+	// When
+	vals, err := c.Values()
+	expected, _ := NewTfVars("test-data/selection/terraform.tfvars", true).Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "a-much-longer-value-than-any-other-SKDJHFKSJDHF", vals[0])
+	assert.ElementsMatch(t, append(expected, "a-much-longer-value-than-any-other-SKDJHFKSJDHF"), vals)
+}
+
+func TestCompositeReplaceables_Values_SourceError(t *testing.T) {
+	// Given
+	c := NewCompositeReplaceables(NewTfVars("test-data/sources/does-not-exist.tfvars", true))
+
+	// When
+	_, err := c.Values()
+
+	// Then
+	assert.Error(t, err)
+}
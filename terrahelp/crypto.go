@@ -3,6 +3,7 @@ package terrahelp
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"regexp"
 	"strings"
@@ -18,12 +19,30 @@ type CryptoHandler struct {
 // to perform the cryptographic actions.
 type CryptoHandlerOpts struct {
 	*TransformOpts
-	EncProvider           string
+	ProviderOpts
 	EncMode               string
-	NamedEncKey           string
-	SimpleKey             string
 	AllowDoubleEncrypt    bool
 	ExcludeWhitespaceOnly bool
+	// Replaceables if set, provides the sensitive values to encrypt in
+	// inline mode instead of the tfvars file
+	Replaceables Replaceables
+	// Selectors if set, select the values within a JSON, YAML or HCL document
+	// (of the DocFormat) which are encrypted in full, taking precedence over the mode
+	Selectors []*PathSelector
+	DocFormat string
+	// Format if set to tfvars, encrypts the string values of a tfvars file
+	// in place, if set to plan, each of the members of a terraform plan file
+	// in full, or if set to binary, the content in full a chunk at a time,
+	// instead of as per the mode
+	Format string
+}
+
+// ProviderOpts holds the options detailing which encryption provider,
+// and which key, should be used for the cryptographic actions.
+type ProviderOpts struct {
+	EncProvider string
+	NamedEncKey string
+	SimpleKey   string
 }
 
 // NewDefaultCryptoHandlerOpts creates CryptoHandlerOpts with all the
@@ -33,10 +52,13 @@ func NewDefaultCryptoHandlerOpts() *CryptoHandlerOpts {
 		TransformOpts: &TransformOpts{TransformItems: []Transformable{
 			NewFileTransformable(TfstateFilename, true, ThBkpExtension),
 			NewFileTransformable(TfstateBkpFilename, true, ThBkpExtension)},
-			TfvarsFilename: TfvarsFilename},
-		EncProvider:           ThEncryptProviderSimple,
-		NamedEncKey:           ThNamedEncryptionKey,
-		SimpleKey:             "",
+			TfvarsFilename:  TfvarsFilename,
+			EncodedVariants: true},
+		ProviderOpts: ProviderOpts{
+			EncProvider: ThEncryptProviderSimple,
+			NamedEncKey: ThNamedEncryptionKey,
+			SimpleKey:   "",
+		},
 		AllowDoubleEncrypt:    true,
 		ExcludeWhitespaceOnly: true,
 		EncMode:               ThEncryptModeFull,
@@ -66,11 +88,24 @@ const (
 const (
 	ThEncryptModeInline = "inline"
 	ThEncryptModeFull   = "full"
+	// ThEncryptModeTfstate is an inline mode which understands tfstate, encrypting
+	// the sensitive values within its resource attributes and outputs only
+	ThEncryptModeTfstate = "tfstate"
+)
+
+// Valid encryption formats
+const (
+	ThEncryptFormatTfvars = "tfvars"
+	// ThEncryptFormatPlan encrypts a terraform plan file member by member
+	ThEncryptFormatPlan = "plan"
+	// ThEncryptFormatBinary encrypts (binary) content in full a chunk at a time
+	ThEncryptFormatBinary = "binary"
 )
 
 type cryptoTransformAction func(*CryptoHandlerOpts, Transformable) error
 
-func (o *CryptoHandlerOpts) getEncryptionKey() string {
+// EncryptionKey returns the key to use with the configured provider
+func (o *ProviderOpts) EncryptionKey() string {
 	switch {
 	case (o.EncProvider == ThEncryptProviderSimple):
 		return o.SimpleKey
@@ -88,9 +123,18 @@ func (o *CryptoHandlerOpts) InlineMode() bool {
 	return o.EncMode == ThEncryptModeInline
 }
 
+func (o *CryptoHandlerOpts) validateFormat() error {
+	switch o.Format {
+	case "", ThEncryptFormatTfvars, ThEncryptFormatPlan, ThEncryptFormatBinary:
+		return nil
+	}
+	return fmt.Errorf("Unknown format %s specified, expected %s, %s or %s", o.Format,
+		ThEncryptFormatTfvars, ThEncryptFormatPlan, ThEncryptFormatBinary)
+}
+
 // ValidateForEncryptDecrypt ensures valid options have been set
 // for the encryption / decruption process
-func (o *CryptoHandlerOpts) ValidateForEncryptDecrypt() error {
+func (o *ProviderOpts) ValidateForEncryptDecrypt() error {
 	if o.EncProvider == ThEncryptProviderSimple && o.SimpleKey == "" {
 		return fmt.Errorf("You must supply a valid simple-key when using the simply provider. " +
 			"The simple provider uses AES and so the AES key should be either 16 or 32 byte to select AES-128 or AES-256 encryption")
@@ -126,6 +170,10 @@ func (t *CryptoHandler) Decrypt(ctx *CryptoHandlerOpts) error {
 // applyCryptoAction will loop through the various items to be encrypted/decrypted, first
 // validating them, and if OK, proceeds to send them on for the actual encryption/decryption
 func (t *CryptoHandler) applyCryptoAction(ctx *CryptoHandlerOpts, cryptoFunc cryptoTransformAction) error {
+	if err := ctx.validateFormat(); err != nil {
+		return err
+	}
+
 	// Do first pass over all items to be encrypted/decrypted to ensure they are
 	// all valid before we begin
 	for _, ci := range ctx.TransformItems {
@@ -153,12 +201,35 @@ func (t *CryptoHandler) encrypt(ctx *CryptoHandlerOpts, ci Transformable) error
 		return err
 	}
 
-	// Read, encrypt, then write out result
+	// Encrypt the content as it is read where possible,
+	// otherwise read, encrypt, then write out result
+	if st, ok := ci.(streamingTransformable); ok && t.streamable(ctx) {
+		in, out := st.stream()
+		return t.encryptStream(ctx, in, out)
+	}
+	if st, ok := ci.(streamingTransformable); ok && ctx.BinaryFormat() {
+		in, out := st.stream()
+		return t.encryptBinary(ctx, in, out)
+	}
 	in, err := ci.read()
 	if err != nil {
 		return err
 	}
-	b, err := t.encryptBytes(ctx, in)
+	var b []byte
+	switch {
+	case len(ctx.Selectors) > 0:
+		b, err = t.encryptSelected(ctx, itemName(ci), in)
+	case ctx.TfvarsFormat():
+		b, err = t.encryptTfvars(ctx, itemName(ci), in)
+	case ctx.PlanFormat():
+		b, err = t.encryptPlan(ctx, in)
+	case ctx.BinaryFormat():
+		var out bytes.Buffer
+		err = t.encryptBinary(ctx, bytes.NewReader(in), &out)
+		b = out.Bytes()
+	default:
+		b, err = t.encryptBytes(ctx, in)
+	}
 	if err != nil {
 		return err
 	}
@@ -167,9 +238,12 @@ func (t *CryptoHandler) encrypt(ctx *CryptoHandlerOpts, ci Transformable) error
 
 func (t *CryptoHandler) encryptBytes(ctx *CryptoHandlerOpts, in []byte) ([]byte, error) {
 	if ctx.InlineMode() {
-		return t.encryptInline(in, ctx.getEncryptionKey(), ctx.TfvarsFilename, ctx.AllowDoubleEncrypt, ctx.ExcludeWhitespaceOnly)
+		return t.encryptInline(ctx, in)
+	}
+	if ctx.TfstateMode() {
+		return t.encryptTfstate(ctx, in)
 	}
-	return t.encryptFullContent(in, ctx.getEncryptionKey(), ctx.AllowDoubleEncrypt)
+	return t.encryptFullContent(in, ctx.EncryptionKey(), ctx.AllowDoubleEncrypt)
 }
 
 func (t *CryptoHandler) decrypt(ctx *CryptoHandlerOpts, ci Transformable) error {
@@ -181,12 +255,26 @@ func (t *CryptoHandler) decrypt(ctx *CryptoHandlerOpts, ci Transformable) error
 		return err
 	}
 
-	// Read, decrypt, then write out result
+	// Decrypt the content as it is read where possible,
+	// otherwise read, decrypt, then write out result
+	if st, ok := ci.(streamingTransformable); ok && ctx.BinaryFormat() {
+		in, out := st.stream()
+		return t.decryptBinary(ctx, in, out)
+	}
+	if st, ok := ci.(streamingTransformable); ok && (ctx.InlineMode() || ctx.TfvarsFormat()) && len(ctx.Selectors) == 0 {
+		in, out := st.stream()
+		return t.decryptStream(ctx, in, out)
+	}
 	ciphertext, err := ci.read()
 	if err != nil {
 		return err
 	}
-	plain, err := t.decryptBytes(ctx, ciphertext)
+	var plain []byte
+	if len(ctx.Selectors) > 0 {
+		plain, err = t.decryptSelected(ctx, itemName(ci), ciphertext)
+	} else {
+		plain, err = t.decryptBytes(ctx, ciphertext)
+	}
 	if err != nil {
 		return err
 	}
@@ -196,10 +284,23 @@ func (t *CryptoHandler) decrypt(ctx *CryptoHandlerOpts, ci Transformable) error
 }
 
 func (t *CryptoHandler) decryptBytes(ctx *CryptoHandlerOpts, in []byte) ([]byte, error) {
-	if ctx.InlineMode() {
-		return t.decryptInline(in, ctx.getEncryptionKey())
+	if ctx.BinaryFormat() {
+		var out bytes.Buffer
+		err := t.decryptBinary(ctx, bytes.NewReader(in), &out)
+		return out.Bytes(), err
 	}
-	return t.Encrypter.Decrypt(ctx.getEncryptionKey(), in)
+	// The values of a tfvars file are encrypted as written, so decrypting
+	// them inline restores the file exactly
+	if ctx.InlineMode() || ctx.TfvarsFormat() {
+		return t.decryptInline(in, ctx.EncryptionKey())
+	}
+	if ctx.TfstateMode() {
+		return t.decryptTfstate(in, ctx.EncryptionKey())
+	}
+	if ctx.PlanFormat() {
+		return t.decryptPlan(ctx, in)
+	}
+	return t.Encrypter.Decrypt(ctx.EncryptionKey(), in)
 }
 
 func (t *CryptoHandler) decryptInline(b []byte, key string) ([]byte, error) {
@@ -228,31 +329,108 @@ func (t *CryptoHandler) encryptFullContent(b []byte, key string, dblEncrypt bool
 	return t.Encrypter.Encrypt(key, b)
 }
 
-// tfvf = tfvars file
-func (t *CryptoHandler) encryptInline(plain []byte, key, tfvf string, dblEncrypt bool, exclWhitespace bool) ([]byte, error) {
+// replaceables returns the Replaceables providing the sensitive values to
+// encrypt in inline mode, by default the (possibly encrypted) tfvars file
+func (t *CryptoHandler) replaceables(ctx *CryptoHandlerOpts) Replaceables {
+	if ctx.Replaceables != nil {
+		return ctx.Replaceables
+	}
+	return NewTfVarsWithSelection(ctx.TfvarsFilename, ctx.ExcludeWhitespaceOnly, ctx.Selection).
+		WithDecryption(t.Encrypter, ctx.EncryptionKey())
+}
 
-	if !dblEncrypt {
-		r := regexp.MustCompile(thCryptoWrapRegExp)
-		m := r.FindSubmatch(plain)
-		if len(m) >= 1 {
-			return nil, newCryptoWrapError(errMsgAlreadyEncrypted)
-		}
+func (t *CryptoHandler) encryptInline(ctx *CryptoHandlerOpts, plain []byte) ([]byte, error) {
+	if err := checkNotEncrypted(ctx, plain); err != nil {
+		return nil, err
 	}
 
-	tfvu := NewTfVars(tfvf, exclWhitespace)
-	inlineCreds, err := tfvu.Values()
+	inlinedText := string(plain)
+	inlineCreds, err := ctx.sensitiveValues(t.replaceables(ctx), inlinedText)
 	if err != nil {
 		return nil, err
 	}
 
-	inlinedText := string(plain)
-	for _, v := range inlineCreds {
-		ct, err := t.Encrypter.Encrypt(key, []byte(v))
-		if err != nil {
-			return nil, err
-		}
-		inlinedText = strings.Replace(inlinedText, v, string(ct), -1)
+	counts := map[string]int{}
+	inlinedText, err = NewReplacer(values(inlineCreds)).Replace(inlinedText, t.encryption(ctx, inlineCreds, counts))
+	if err != nil {
+		return nil, err
 	}
+	ctx.logReplacements("encrypted", counts)
 
 	return []byte(inlinedText), nil
 }
+
+// streamable returns true if encrypting content as it is read gives exactly the
+// same result as encrypting it all at once, which is only the case for inline
+// encryption without detectors (as values may be detected after an earlier occurrence)
+func (t *CryptoHandler) streamable(ctx *CryptoHandlerOpts) bool {
+	return ctx.InlineMode() && ctx.Format == "" && len(ctx.Detectors) == 0 && len(ctx.Selectors) == 0
+}
+
+func (t *CryptoHandler) encryptStream(ctx *CryptoHandlerOpts, in io.Reader, out io.Writer) error {
+	inlineCreds, err := ctx.sensitiveValues(t.replaceables(ctx), "")
+	if err != nil {
+		return err
+	}
+
+	r := NewReplacer(values(inlineCreds))
+	counts := map[string]int{}
+	enc := t.encryption(ctx, inlineCreds, counts)
+	err = transformStream(in, out, func(seg string, final bool) (string, string, error) {
+		if err := checkNotEncrypted(ctx, []byte(seg)); err != nil {
+			return "", "", err
+		}
+		return r.ReplacePrefix(seg, final, enc)
+	})
+	ctx.logReplacements("encrypted", counts)
+	return err
+}
+
+func (t *CryptoHandler) decryptStream(ctx *CryptoHandlerOpts, in io.Reader, out io.Writer) error {
+	key := ctx.EncryptionKey()
+	return transformStream(in, out, func(seg string, final bool) (string, string, error) {
+		// Segments are made up of whole lines (which wrapped ciphertext never spans),
+		// other than when a very long line is split, so carry over any partial wrapper
+		carry := ""
+		if !final && !strings.HasSuffix(seg, "\n") {
+			if i := strings.LastIndexByte(seg, '@'); i >= 0 && !strings.Contains(seg[i:], thCryptoWrapSuffix) {
+				seg, carry = seg[:i], seg[i:]
+			}
+		}
+		b, err := t.decryptInline([]byte(seg), key)
+		return string(b), carry, err
+	})
+}
+
+// checkNotEncrypted ensures the content holds no encrypted values,
+// unless double encryption has been allowed
+func checkNotEncrypted(ctx *CryptoHandlerOpts, b []byte) error {
+	if !ctx.AllowDoubleEncrypt {
+		r := regexp.MustCompile(thCryptoWrapRegExp)
+		m := r.FindSubmatch(b)
+		if len(m) >= 1 {
+			return newCryptoWrapError(errMsgAlreadyEncrypted)
+		}
+	}
+	return nil
+}
+
+// encryption returns the function providing the ciphertext for each of the
+// sensitive values, counting how many occurrences of each are encrypted.
+// Each value is encrypted once, so all its occurrences share the same ciphertext.
+func (t *CryptoHandler) encryption(ctx *CryptoHandlerOpts, inlineCreds []SourcedValue, counts map[string]int) func(int) (string, error) {
+	key := ctx.EncryptionKey()
+	encrypted := map[int]string{}
+	return func(i int) (string, error) {
+		counts[inlineCreds[i].Name()]++
+		if ct, ok := encrypted[i]; ok {
+			return ct, nil
+		}
+		ct, err := t.Encrypter.Encrypt(key, []byte(inlineCreds[i].Value))
+		if err != nil {
+			return "", err
+		}
+		encrypted[i] = string(ct)
+		return encrypted[i], nil
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"testing"
 )
 
@@ -38,6 +39,19 @@ func defaultVaultEncryptableCryptoHandlerOpts(t *testing.T, noBkp bool) *CryptoH
 	return ctx
 }
 
+// testSimpleKey is the (AES-256) key used with the simple provider by the tests
+const testSimpleKey = "AES256Key-32Characters0987654321"
+
+// defaultTestSimpleCryptoHandlerOpts creates the default CryptoHandlerOpts for
+// the mode and format, using the simple provider with the test key
+func defaultTestSimpleCryptoHandlerOpts(mode, format string) *CryptoHandlerOpts {
+	ctx := NewDefaultCryptoHandlerOpts()
+	ctx.EncMode = mode
+	ctx.Format = format
+	ctx.SimpleKey = testSimpleKey
+	return ctx
+}
+
 func defaultTestInlineCryptoHandlerOpts(t *testing.T, noBkp bool) *CryptoHandlerOpts {
 	ctx := NewDefaultCryptoHandlerOpts()
 	ctx.EncProvider = ThEncryptProviderVault
@@ -516,3 +530,44 @@ func TestCryptoHandler_VaultEncrypter_Encrypt_inline_missingTfvarsFile(t *testin
 	// Then
 	assert.Error(t, err, "Missing tfvars should result in an error")
 }
+
+func TestCryptoHandler_VaultEncrypter_Encrypt_inlineWithEncryptedTfvars(t *testing.T) {
+	// Given a known original project setup in temp dir
+	// whose tfvars file has itself been fully encrypted ...
+	tp, tu, _ := newVaultEncryptableExampleProject(t, "original")
+	defer tp.restore()
+	tfvCtx := defaultTestInlineCryptoHandlerOpts(t, true)
+	tfvCtx.EncMode = ThEncryptModeFull
+	tfvCtx.TransformItems = []Transformable{NewFileTransformable(TfvarsFilename, false, "")}
+	err := tu.Encrypt(tfvCtx)
+	assert.NoError(t, err)
+	ctx := defaultTestInlineCryptoHandlerOpts(t, true)
+
+	// When
+	err = tu.Encrypt(ctx)
+
+	// Then the tfstate files should be encrypted as if the tfvars were in plaintext
+	assert.NoError(t, err)
+	tp.assertExpectedFileContent(TfstateFilename, "test-data/example-project/encrypted-inline/terraform.tfstate")
+	tp.assertExpectedFileContent(TfstateBkpFilename, "test-data/example-project/encrypted-inline/terraform.tfstate.backup")
+}
+
+func TestCryptoHandler_encryptInline_ValueWithinCiphertext(t *testing.T) {
+	// Given sensitive values, one of which appears within the
+	// encrypted wrapper produced for the other
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeInline, "")
+	ctx.EncodedVariants = false
+	ctx.Replaceables = &DefaultReplaceables{[]string{"my-password-KSJDH", "terrahelp"}}
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	plain := []byte(`password = "my-password-KSJDH", user = "terrahelp"`)
+
+	// When
+	enc, err := h.encryptInline(ctx, plain)
+	assert.NoError(t, err)
+	dec, err := h.decryptInline(enc, ctx.EncryptionKey())
+
+	// Then each value is encrypted exactly once, and decrypts intact
+	assert.NoError(t, err)
+	assert.Len(t, regexp.MustCompile(thCryptoWrapRegExp).FindAll(enc, -1), 2)
+	assert.Equal(t, string(plain), string(dec))
+}
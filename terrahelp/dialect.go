@@ -0,0 +1,229 @@
+package terrahelp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Supported terraform output dialects, DialectAuto detects
+// the dialect from the content being masked
+const (
+	DialectAuto     = "auto"
+	DialectPre012   = "pre012"
+	DialectTf012    = "tf012"
+	DialectOpenTofu = "opentofu"
+)
+
+// prevPatternMaskPlaceholder is replaced, within a PrevValuePattern,
+// by a regex matching an already masked value
+const prevPatternMaskPlaceholder = "{{mask}}"
+
+// Source recorded against previous values found by a PrevValuePattern
+const prevValueSource = "previous-value"
+
+// prevPatternGroup is the name of the capture group holding the
+// previous value within a PrevValuePattern
+const prevPatternGroup = "prev"
+
+// PrevValuePattern describes where a previous sensitive value is exposed in
+// terraform output, typically alongside an already masked current value
+type PrevValuePattern struct {
+	ID          string
+	Description string
+	// Pattern is a regex holding the previous value in its prev named
+	// capture group (or if there is none, its first capture group).
+	// Within it {{mask}} matches an already masked value.
+	Pattern string
+}
+
+// OutputDialect is a versioned set of PrevValuePatterns for the way
+// a particular terraform (or compatible tool) version renders changes
+type OutputDialect struct {
+	Name        string
+	Version     string
+	Description string
+	// markers identify content rendered in this dialect
+	markers  []*regexp.Regexp
+	Patterns []*PrevValuePattern
+}
+
+var tf012PrevValuePatterns = []*PrevValuePattern{
+	{
+		ID:          "attribute-change",
+		Description: `In place attribute changes e.g. ~ password = "old" -> "******"`,
+		Pattern:     `(?:=\s*|:\s*)(?P<prev>".+")\s*->\s*"{{mask}}"`,
+	},
+	{
+		ID:          "sensitive-hint",
+		Description: `Attributes becoming sensitive e.g. ~ password = "old" -> (sensitive value)`,
+		Pattern:     `(?:=\s*|:\s*)(?P<prev>".+")\s*->\s*\(sensitive(?: value)?\)`,
+	},
+	{
+		ID:          "heredoc-change",
+		Description: "Changed lines within heredoc (and jsonencode/yamlencode multi line) diffs",
+		Pattern:     `(?m)^[ \t]*-[ \t]+(?P<prev>\S.*?)[ \t]*\n[ \t]*\+[ \t]+{{mask}}[ \t]*$`,
+	},
+}
+
+// OutputDialects returns the supported terraform output dialects, in
+// the order they are checked when auto detecting the dialect
+func OutputDialects() []*OutputDialect {
+	return []*OutputDialect{
+		{
+			Name:        DialectOpenTofu,
+			Version:     "1",
+			Description: "OpenTofu plan and apply output",
+			markers: []*regexp.Regexp{
+				regexp.MustCompile(`OpenTofu (?:will perform|used the selected providers|has compared)`),
+			},
+			Patterns: tf012PrevValuePatterns,
+		},
+		{
+			Name:        DialectTf012,
+			Version:     "1",
+			Description: "Terraform 0.12 and later plan and apply output",
+			markers: []*regexp.Regexp{
+				regexp.MustCompile(`Terraform used the selected providers`),
+				regexp.MustCompile(`(?m)^\s*# \S+ (?:will be|must be|has been) `),
+				regexp.MustCompile(`(?m)^\s*[~+-] [\w"-]+\s+= .* -> `),
+			},
+			Patterns: tf012PrevValuePatterns,
+		},
+		{
+			Name:        DialectPre012,
+			Version:     "1",
+			Description: "Terraform 0.11 and earlier plan and apply output",
+			markers: []*regexp.Regexp{
+				regexp.MustCompile(`(?m)^\s+[\w.#%-]+:\s+".*" => `),
+			},
+			Patterns: []*PrevValuePattern{
+				{
+					ID:          "attribute-change",
+					Description: `Attribute changes e.g. password: "old" => "******"`,
+					Pattern:     `(?:=\s*|:\s*)(?P<prev>".+")\s*=>\s*"{{mask}}"`,
+				},
+			},
+		},
+	}
+}
+
+// LookupOutputDialect returns the named output dialect, or
+// nil should the dialect be auto detected
+func LookupOutputDialect(name string) (*OutputDialect, error) {
+	if name == "" || name == DialectAuto {
+		return nil, nil
+	}
+	for _, d := range OutputDialects() {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown output dialect %s specified", name)
+}
+
+// DetectOutputDialect returns the dialect the content is rendered
+// in, or nil should it not be possible to tell
+func DetectOutputDialect(content string) *OutputDialect {
+	for _, d := range OutputDialects() {
+		for _, m := range d.markers {
+			if m.MatchString(content) {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// ValidatePrevValuePattern checks the pattern compiles and
+// has a capture group holding the previous value
+func ValidatePrevValuePattern(p *PrevValuePattern) error {
+	r, err := p.compile(fixedMaskRegExp(MaskChar))
+	if err != nil {
+		return fmt.Errorf("Previous value pattern %s is invalid : %s", p.ID, err)
+	}
+	if r.NumSubexp() == 0 {
+		return fmt.Errorf("Previous value pattern %s has no capture group", p.ID)
+	}
+	return nil
+}
+
+// compile compiles the pattern, with {{mask}} replaced by the regex matching a masked value
+func (p *PrevValuePattern) compile(masked string) (*regexp.Regexp, error) {
+	return regexp.Compile(strings.Replace(p.Pattern, prevPatternMaskPlaceholder, masked, -1))
+}
+
+// prevValues returns the previous values exposed by the pattern within the content
+// (with masked values matching the masked regex), each along with the replacement
+// to use for it, as provided by mask (quoted values have their content masked).
+// Each is named after the pattern, or the name within the named mask it precedes.
+func (p *PrevValuePattern) prevValues(content, masked string, mask func(sv SourcedValue) (string, error)) ([]SourcedValue, error) {
+	r, err := p.compile(masked)
+	if err != nil {
+		return nil, fmt.Errorf("Previous value pattern %s is invalid : %s", p.ID, err)
+	}
+	g := r.SubexpIndex(prevPatternGroup)
+	for i, n := range r.SubexpNames() {
+		if g < 0 && i > 0 && n != maskNameGroup {
+			g = i
+		}
+	}
+	if g < 0 {
+		return nil, fmt.Errorf("Previous value pattern %s has no capture group", p.ID)
+	}
+
+	var svs []SourcedValue
+	for _, m := range r.FindAllStringSubmatch(content, -1) {
+		prev := m[g]
+		if prev == "" {
+			continue
+		}
+		sv := SourcedValue{Value: prev, Source: prevValueSource, Variable: p.ID}
+		if n := r.SubexpIndex(maskNameGroup); n > 0 && m[n] != "" {
+			sv.Variable = m[n]
+		}
+		quoted := len(prev) > 1 && strings.HasPrefix(prev, `"`) && strings.HasSuffix(prev, `"`)
+		if quoted {
+			sv.Value = prev[1 : len(prev)-1]
+		}
+		rep, err := mask(sv)
+		if err != nil {
+			return nil, err
+		}
+		if quoted {
+			rep = fmt.Sprintf(PrevVal2MaskedValReplacePattern, rep)
+		}
+		sv.Value, sv.replacement = prev, rep
+		svs = append(svs, sv)
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// prevValuePatterns returns the patterns to apply to the content, those of the
+// configured (or detected) dialect, followed by any user defined ones. Should
+// the dialect not be detected the patterns of every dialect are applied.
+func (m *MaskOpts) prevValuePatterns(content string) ([]*PrevValuePattern, error) {
+	d, err := LookupOutputDialect(m.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = DetectOutputDialect(content)
+	}
+
+	dialects := OutputDialects()
+	if d != nil {
+		dialects = []*OutputDialect{d}
+	}
+	var pats []*PrevValuePattern
+	seen := map[string]bool{}
+	for _, d := range dialects {
+		for _, p := range d.Patterns {
+			if !seen[p.Pattern] {
+				seen[p.Pattern] = true
+				pats = append(pats, p)
+			}
+		}
+	}
+	return append(pats, m.PrevPatterns...), nil
+}
@@ -0,0 +1,112 @@
+package terrahelp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Current sensitive values within the plan output corpus (test-data/plan-outputs),
+// the previous values are not known and must be found by the dialect patterns
+var planOutputSensitiveValues = []string{"db-password-NEW-KSJDH", "api-key-NEW-DKSJH", "cert-line-NEW-SKDJ"}
+
+func TestMasker_maskBytes_PlanOutputCorpus(t *testing.T) {
+	files, err := filepath.Glob("test-data/plan-outputs/*/*.txt")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, f := range files {
+		// Given a plan output, rendered in the dialect of the directory it is in
+		dialect := filepath.Base(filepath.Dir(f))
+		in, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+		expected, err := ioutil.ReadFile(strings.TrimSuffix(f, ".txt") + ".masked")
+		assert.NoError(t, err)
+
+		for _, d := range []string{DialectAuto, dialect} {
+			ctx := NewDefaultMaskOpts()
+			ctx.Dialect = d
+			m := NewMasker(ctx, &DefaultReplaceables{planOutputSensitiveValues})
+
+			// When
+			actual, err := m.maskBytes(in)
+
+			// Then both the current and previous values are masked
+			assert.NoError(t, err, f)
+			assert.Equal(t, string(expected), string(actual), "%s using dialect %s", f, d)
+		}
+	}
+}
+
+func TestDetectOutputDialect(t *testing.T) {
+	files, err := filepath.Glob("test-data/plan-outputs/*/*.txt")
+	assert.NoError(t, err)
+
+	for _, f := range files {
+		// Given
+		in, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+
+		// When
+		d := DetectOutputDialect(string(in))
+
+		// Then
+		if assert.NotNil(t, d, f) {
+			assert.Equal(t, filepath.Base(filepath.Dir(f)), d.Name, f)
+		}
+	}
+	assert.Nil(t, DetectOutputDialect("hello there"))
+}
+
+func TestLookupOutputDialect(t *testing.T) {
+	d, err := LookupOutputDialect(DialectTf012)
+	assert.NoError(t, err)
+	assert.Equal(t, DialectTf012, d.Name)
+
+	d, err = LookupOutputDialect(DialectAuto)
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+
+	_, err = LookupOutputDialect("tf099")
+	assert.EqualError(t, err, "Unknown output dialect tf099 specified")
+}
+
+func TestMasker_maskBytes_UserPrevValuePattern(t *testing.T) {
+	// Given a user defined pattern for a custom log format
+	ctx := NewDefaultMaskOpts()
+	ctx.PrevPatterns = []*PrevValuePattern{
+		{ID: "rotated", Pattern: `rotated from (\S+) to {{mask}}`},
+	}
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{"new-secret-SKDJH"}})
+
+	// When
+	actual, err := m.maskBytes([]byte("rotated from old-secret-DJSKH to new-secret-SKDJH\nold-secret-DJSKH"))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated from ****** to ******\n******", string(actual))
+}
+
+func TestMasker_maskBytes_WrongDialect(t *testing.T) {
+	// Given a terraform 0.12 plan output, masked using the pre 0.12 dialect
+	ctx := NewDefaultMaskOpts()
+	ctx.Dialect = DialectPre012
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{"new-secret-SKDJH"}})
+
+	// When
+	actual, err := m.maskBytes([]byte(`~ password = "old-secret-DJSKH" -> "new-secret-SKDJH"`))
+
+	// Then the previous value is not found
+	assert.NoError(t, err)
+	assert.Equal(t, `~ password = "old-secret-DJSKH" -> "******"`, string(actual))
+}
+
+func TestValidatePrevValuePattern(t *testing.T) {
+	assert.NoError(t, ValidatePrevValuePattern(&PrevValuePattern{ID: "a", Pattern: `(?P<prev>\S+) -> {{mask}}`}))
+	assert.EqualError(t, ValidatePrevValuePattern(&PrevValuePattern{ID: "a", Pattern: `\S+ -> {{mask}}`}),
+		"Previous value pattern a has no capture group")
+	assert.Error(t, ValidatePrevValuePattern(&PrevValuePattern{ID: "a", Pattern: `(\S+ -> {{mask}}`}))
+}
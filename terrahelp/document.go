@@ -0,0 +1,493 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported document formats, which values can be selected from by path
+const (
+	DocFormatAuto = "auto"
+	DocFormatJSON = "json"
+	DocFormatYAML = "yaml"
+	DocFormatHCL  = "hcl"
+)
+
+type docNodeKind int
+
+const (
+	// docScalar is a value other than a string (e.g. a number), or
+	// an expression (in HCL) which is not a literal
+	docScalar docNodeKind = iota
+	docString
+	docObject
+	docArray
+)
+
+// docNode is a value within a parsed (JSON, YAML or HCL) document, each string
+// recording where, from start to end, it is held within the document source
+type docNode struct {
+	kind docNodeKind
+	// keys holds the key of each of the children of an object
+	keys     []string
+	children []*docNode
+	// value is the decoded value of a string, or the text of a scalar
+	value      string
+	start, end int
+	// flow is true for (YAML) values held within a flow (i.e. JSON like) collection
+	flow bool
+}
+
+func (n *docNode) add(key string, c *docNode) {
+	n.keys = append(n.keys, key)
+	n.children = append(n.children, c)
+}
+
+// child returns the child of the object with the key, or nil
+func (n *docNode) child(key string) *docNode {
+	for i, k := range n.keys {
+		if k == key {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// strings returns the strings held at, or anywhere beneath, the node
+func (n *docNode) strings() []*docNode {
+	if n.kind == docString {
+		return []*docNode{n}
+	}
+	var all []*docNode
+	for _, c := range n.children {
+		all = append(all, c.strings()...)
+	}
+	return all
+}
+
+// walkStrings calls f with the path to, and the start and end offsets of, each
+// string beneath the node, each array element being recorded as jsonArrayElem
+func (n *docNode) walkStrings(path []string, f func(path []string, start, end int) error) error {
+	switch n.kind {
+	case docString:
+		return f(path, n.start, n.end)
+	case docObject, docArray:
+		for i, c := range n.children {
+			elem := jsonArrayElem
+			if n.kind == docObject {
+				elem = n.keys[i]
+			}
+			if err := c.walkStrings(append(path, elem), f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// document is a parsed JSON, YAML (possibly holding several documents) or HCL document
+type document struct {
+	src    string
+	format string
+	roots  []*docNode
+}
+
+// docFormat returns the format of the document, determined by the extension
+// of its filename where possible, otherwise by which format it parses as
+func docFormat(filename, src string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".tfstate":
+		return DocFormatJSON
+	case ".yaml", ".yml":
+		return DocFormatYAML
+	case ".hcl", ".tf", ".tfvars":
+		return DocFormatHCL
+	}
+	if json.Valid([]byte(src)) {
+		return DocFormatJSON
+	}
+	if _, diags := hclsyntax.ParseConfig([]byte(src), filename, hcl.Pos{Line: 1, Column: 1}); !diags.HasErrors() {
+		return DocFormatHCL
+	}
+	return DocFormatYAML
+}
+
+// parseDocument parses the document in the format, or if DocFormatAuto
+// (or not set) in the format determined from its filename or content
+func parseDocument(filename, src, format string) (*document, error) {
+	if format == "" || format == DocFormatAuto {
+		format = docFormat(filename, src)
+	}
+	d := &document{src: src, format: format}
+	var err error
+	switch format {
+	case DocFormatJSON:
+		var root *docNode
+		if root, err = parseJSONDocument(src); err == nil {
+			d.roots = []*docNode{root}
+		}
+	case DocFormatYAML:
+		d.roots, err = parseYAMLDocument(src)
+	case DocFormatHCL:
+		var root *docNode
+		if root, err = parseHCLDocument(filename, src); err == nil {
+			d.roots = []*docNode{root}
+		}
+	default:
+		return nil, fmt.Errorf("Unknown document format %s specified", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s as %s : %s", filename, format, err)
+	}
+	return d, nil
+}
+
+// replace replaces each of the strings with the (encoded) value f provides for it,
+// leaving the rest of the document as is, and should f return the value unchanged,
+// the string as is
+func (d *document) replace(strs []*docNode, f func(v string) (string, error)) (string, error) {
+	sort.Slice(strs, func(i, j int) bool { return strs[i].start < strs[j].start })
+	var sb strings.Builder
+	last := 0
+	for _, n := range strs {
+		v, err := f(n.value)
+		if err != nil {
+			return "", err
+		}
+		if v == n.value || n.start < last {
+			continue
+		}
+		sb.WriteString(d.src[last:n.start])
+		sb.WriteString(d.encode(n, v))
+		last = n.end
+	}
+	sb.WriteString(d.src[last:])
+	return sb.String(), nil
+}
+
+// encode returns the string as it is to be held, in place of the node, within the document
+func (d *document) encode(n *docNode, v string) string {
+	switch d.format {
+	case DocFormatYAML:
+		if !n.flow {
+			if b, err := yaml.Marshal(v); err == nil && strings.Count(string(b), "\n") == 1 {
+				return strings.TrimSuffix(string(b), "\n")
+			}
+		}
+		return encodeJSONString(v)
+	case DocFormatHCL:
+		return `"` + hclEscaper.Replace(v) + `"`
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// parseJSONDocument parses the (valid) JSON document
+func parseJSONDocument(src string) (*docNode, error) {
+	if !json.Valid([]byte(src)) {
+		return nil, fmt.Errorf("not valid JSON")
+	}
+	p := &jsonParser{src: src}
+	return p.value()
+}
+
+type jsonParser struct {
+	src string
+	pos int
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *jsonParser) value() (*docNode, error) {
+	p.skipSpace()
+	switch p.src[p.pos] {
+	case '{':
+		n := &docNode{kind: docObject}
+		return n, p.elements('}', func() error {
+			key, err := p.string()
+			if err != nil {
+				return err
+			}
+			p.skipSpace()
+			p.pos++ // the colon
+			c, err := p.value()
+			n.add(key.value, c)
+			return err
+		})
+	case '[':
+		n := &docNode{kind: docArray}
+		return n, p.elements(']', func() error {
+			c, err := p.value()
+			n.add("", c)
+			return err
+		})
+	case '"':
+		return p.string()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(",}] \t\r\n", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return &docNode{kind: docScalar, value: p.src[start:p.pos]}, nil
+}
+
+func (p *jsonParser) string() (*docNode, error) {
+	n := &docNode{kind: docString, start: p.pos, end: jsonStringEnd(p.src, p.pos)}
+	p.pos = n.end
+	return n, json.Unmarshal([]byte(p.src[n.start:n.end]), &n.value)
+}
+
+// elements parses the elements of the object or array, up to its closing char
+func (p *jsonParser) elements(closing byte, element func() error) error {
+	p.pos++
+	for {
+		p.skipSpace()
+		switch p.src[p.pos] {
+		case closing:
+			p.pos++
+			return nil
+		case ',':
+			p.pos++
+			continue
+		}
+		if err := element(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseYAMLDocument parses each of the documents within the YAML stream
+func parseYAMLDocument(src string) ([]*docNode, error) {
+	p := &yamlParser{src: src, lines: []int{0}}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+	dec := yaml.NewDecoder(strings.NewReader(src))
+	var roots []*docNode
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return roots, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range doc.Content {
+			root, err := p.node(n, false)
+			if err != nil {
+				return nil, err
+			}
+			roots = append(roots, root)
+		}
+	}
+}
+
+type yamlParser struct {
+	src string
+	// lines holds the offset at which each line starts
+	lines []int
+}
+
+func (p *yamlParser) node(n *yaml.Node, flow bool) (*docNode, error) {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		dn := &docNode{kind: docArray, flow: flow}
+		if n.Kind == yaml.MappingNode {
+			dn.kind = docObject
+		}
+		flow = flow || n.Style&yaml.FlowStyle != 0
+		for i := 0; i < len(n.Content); i++ {
+			key := ""
+			if n.Kind == yaml.MappingNode {
+				key = n.Content[i].Value
+				i++
+			}
+			c, err := p.node(n.Content[i], flow)
+			if err != nil {
+				return nil, err
+			}
+			dn.add(key, c)
+		}
+		return dn, nil
+	case yaml.ScalarNode:
+		if n.ShortTag() != "!!str" {
+			return &docNode{kind: docScalar, value: n.Value, flow: flow}, nil
+		}
+		start := p.offset(n.Line, n.Column)
+		end, err := p.scalarEnd(n, start, flow)
+		if err != nil {
+			return nil, err
+		}
+		return &docNode{kind: docString, value: n.Value, start: start, end: end, flow: flow}, nil
+	}
+	return &docNode{kind: docScalar, flow: flow}, nil
+}
+
+// offset returns the offset of the (1 based) line and column
+func (p *yamlParser) offset(line, col int) int {
+	o := p.lines[line-1]
+	for ; col > 1 && o < len(p.src); col-- {
+		_, w := utf8.DecodeRuneInString(p.src[o:])
+		o += w
+	}
+	return o
+}
+
+// scalarEnd returns where the string scalar, starting at the offset, ends
+func (p *yamlParser) scalarEnd(n *yaml.Node, start int, flow bool) (int, error) {
+	src := p.src
+	switch {
+	case n.Style&yaml.DoubleQuotedStyle != 0:
+		return jsonStringEnd(src, start), nil
+	case n.Style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(src); i++ {
+			if src[i] == '\'' {
+				if i+1 < len(src) && src[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+		return len(src), nil
+	case n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		// The block continues until a line indented no further than the one it starts on
+		indent := p.indent(n.Line)
+		end := strings.IndexByte(src[start:], '\n')
+		if end < 0 {
+			return len(src), nil
+		}
+		end += start
+		for l := n.Line; l < len(p.lines); l++ {
+			line := strings.TrimRight(p.line(l+1), "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if p.indent(l+1) <= indent {
+				break
+			}
+			end = p.lines[l] + len(line)
+		}
+		return end, nil
+	}
+
+	// Plain scalars end at a comment, the end of the line or (in flow collections) an indicator
+	line := p.line(n.Line)
+	end := start + len(line) - (start - p.lines[n.Line-1])
+	for i := start; i < end; i++ {
+		if (src[i] == '#' && i > start && (src[i-1] == ' ' || src[i-1] == '\t')) ||
+			(flow && strings.IndexByte(",]}", src[i]) >= 0) {
+			end = i
+			break
+		}
+	}
+	end = start + len(strings.TrimRight(src[start:end], " \t\r"))
+	if src[start:end] != n.Value {
+		return 0, fmt.Errorf("multi-line plain scalars are not supported (line %d)", n.Line)
+	}
+	return end, nil
+}
+
+// line returns the (1 based) line, without its newline
+func (p *yamlParser) line(l int) string {
+	s := p.src[p.lines[l-1]:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// indent returns the indentation of the (1 based) line
+func (p *yamlParser) indent(l int) int {
+	line := p.line(l)
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// parseHCLDocument parses the HCL document, its blocks being held as
+// nested objects, keyed by their type and then each of their labels
+func parseHCLDocument(filename, src string) (*docNode, error) {
+	file, diags := hclsyntax.ParseConfig([]byte(src), filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	root := &docNode{kind: docObject}
+	hclBody(root, file.Body.(*hclsyntax.Body))
+	return root, nil
+}
+
+func hclBody(n *docNode, body *hclsyntax.Body) {
+	attrs := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, a := range body.Attributes {
+		attrs = append(attrs, a)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte })
+	for _, a := range attrs {
+		n.add(a.Name, hclExpr(a.Expr))
+	}
+	for _, b := range body.Blocks {
+		bn := n
+		for _, k := range append([]string{b.Type}, b.Labels...) {
+			c := bn.child(k)
+			if c == nil || c.kind != docObject {
+				c = &docNode{kind: docObject}
+				bn.add(k, c)
+			}
+			bn = c
+		}
+		hclBody(bn, b.Body)
+	}
+}
+
+func hclExpr(expr hclsyntax.Expression) *docNode {
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		var sb strings.Builder
+		for _, p := range e.Parts {
+			lit, ok := p.(*hclsyntax.LiteralValueExpr)
+			if !ok || lit.Val.Type() != cty.String {
+				return &docNode{kind: docScalar}
+			}
+			sb.WriteString(lit.Val.AsString())
+		}
+		r := e.SrcRange
+		return &docNode{kind: docString, value: sb.String(), start: r.Start.Byte, end: r.End.Byte}
+	case *hclsyntax.LiteralValueExpr:
+		if e.Val.IsKnown() && !e.Val.IsNull() && (e.Val.Type() == cty.Number || e.Val.Type() == cty.Bool) {
+			return &docNode{kind: docScalar, value: fmt.Sprint(ctyToGo(e.Val))}
+		}
+	case *hclsyntax.ObjectConsExpr:
+		n := &docNode{kind: docObject}
+		for _, item := range e.Items {
+			k, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || !k.IsKnown() || k.IsNull() || k.Type() != cty.String {
+				continue
+			}
+			n.add(k.AsString(), hclExpr(item.ValueExpr))
+		}
+		return n
+	case *hclsyntax.TupleConsExpr:
+		n := &docNode{kind: docArray}
+		for _, c := range e.Exprs {
+			n.add("", hclExpr(c))
+		}
+		return n
+	}
+	return &docNode{kind: docScalar}
+}
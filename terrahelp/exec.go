@@ -0,0 +1,45 @@
+package terrahelp
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Executor runs a command (typically terraform) under a pseudo-terminal, so it
+// behaves as it would interactively (i.e. with colours and approval prompts),
+// masking both its stdout and stderr as they are written
+type Executor struct {
+	masker *Masker
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// NewExecutor creates a new Executor masking with the Masker
+func NewExecutor(m *Masker) *Executor {
+	return &Executor{masker: m, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+// Run runs the command, forwarding stdin and signals to it, returning its exit
+// status once it, along with the masking of its output, has finished
+func (e *Executor) Run(name string, args ...string) (int, error) {
+	if e.masker.ctx.Format == MaskFormatPlan {
+		return 0, fmt.Errorf("The %s format can not be used to mask the output of a command", MaskFormatPlan)
+	}
+	if err := e.masker.start(); err != nil {
+		return 0, err
+	}
+	defer e.masker.closeTee()
+	if e.masker.teeFilename != "" {
+		// stderr is kept apart, so it is known which stream each part came from
+		if err := e.masker.openTee(teeStderr); err != nil {
+			return 0, err
+		}
+	}
+	code, err := e.run(name, args...)
+	if err != nil {
+		return code, err
+	}
+	return code, e.masker.finish()
+}
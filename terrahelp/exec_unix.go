@@ -0,0 +1,145 @@
+//go:build !windows
+// +build !windows
+
+package terrahelp
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// Signals forwarded to the command
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+func (e *Executor) run(name string, args ...string) (int, error) {
+	// Separate terminals for stdout and stderr, so both are
+	// seen as terminals while being masked independently
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer ptmx.Close()
+	eptmx, etty, err := pty.Open()
+	if err != nil {
+		tty.Close()
+		return 0, err
+	}
+	defer eptmx.Close()
+
+	stdin, interactive := e.stdin.(*os.File)
+	interactive = interactive && term.IsTerminal(int(stdin.Fd()))
+	resize := func() {
+		if interactive {
+			pty.InheritSize(stdin, ptmx)
+			pty.InheritSize(stdin, eptmx)
+		}
+	}
+	resize()
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, etty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	err = cmd.Start()
+	tty.Close()
+	etty.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// Input is passed through as is, the terminal of the command
+	// (rather than our own) handling any line editing and echoing
+	if interactive {
+		state, err := term.MakeRaw(int(stdin.Fd()))
+		if err == nil {
+			defer term.Restore(int(stdin.Fd()), state)
+		}
+	}
+	go func() {
+		io.Copy(ptmx, e.stdin)
+		if !interactive {
+			// End of input (^D)
+			ptmx.Write([]byte{4})
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, append(forwardedSignals, syscall.SIGWINCH)...)
+	defer signal.Stop(sigs)
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGWINCH {
+				resize()
+				continue
+			}
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, s := range []struct {
+		name   string
+		stream string
+		in     io.Reader
+		out    io.Writer
+	}{{"stdout", "", ptyReader{ptmx}, e.stdout}, {"stderr", teeStderr, ptyReader{eptmx}, e.stderr}} {
+		wg.Add(1)
+		go func(i int, name, stream string, in io.Reader, out io.Writer) {
+			defer wg.Done()
+			if errs[i] = e.masker.maskLive(name, e.masker.teeReader(stream, in), out); errs[i] != nil {
+				// Its output can no longer be masked, so stop the command (along with any
+				// processes it started), discarding what it has still to write, rather
+				// than leaving it blocked writing to a full terminal
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				io.Copy(ioutil.Discard, in)
+			}
+		}(i, s.name, s.stream, s.in, s.out)
+	}
+
+	werr := cmd.Wait()
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	return exitStatus(werr)
+}
+
+// ptyReader reads from the controlling side of a pseudo-terminal, reporting the
+// error on reading once the command (and so its side) has closed as the end of file
+type ptyReader struct {
+	f *os.File
+}
+
+func (r ptyReader) Read(b []byte) (int, error) {
+	n, err := r.f.Read(b)
+	if errors.Is(err, syscall.EIO) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// exitStatus returns the exit status of the command, which like a shell, is
+// 128 plus the signal number should the command have been killed by a signal
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return ee.ExitCode(), nil
+	}
+	return 0, err
+}
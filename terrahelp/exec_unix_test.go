@@ -0,0 +1,210 @@
+//go:build !windows
+// +build !windows
+
+package terrahelp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testExecutor(ctx *MaskOpts, stdin string) (*Executor, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	e := NewExecutor(NewMasker(ctx, &DefaultReplaceables{[]string{"sensitive-value-1", "old-secret-DJSKH"}}))
+	e.stdin, e.stdout, e.stderr = strings.NewReader(stdin), &stdout, &stderr
+	return e, &stdout, &stderr
+}
+
+func TestExecutor_Run_MasksStdoutAndStderr(t *testing.T) {
+	// Given a command writing sensitive data to stdout and stderr, and failing
+	ctx := NewDefaultMaskOpts()
+	e, stdout, stderr := testExecutor(ctx, "")
+
+	// When
+	code, err := e.Run("sh", "-c", `echo "out sensitive-value-1"; echo "err sensitive-value-1" >&2; exit 3`)
+
+	// Then its output is masked, and its exit status returned
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "out ******\r\n", stdout.String())
+	assert.Equal(t, "err ******\r\n", stderr.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestExecutor_Run_MaskedOutputCanNotBeWritten(t *testing.T) {
+	// Given output which can not be written, from a command writing more
+	// than the terminal holds
+	ctx := NewDefaultMaskOpts()
+	e, _, _ := testExecutor(ctx, "")
+	e.stdout = failingWriter{}
+
+	// When
+	done := make(chan error, 1)
+	go func() {
+		_, err := e.Run("sh", "-c", `while :; do echo "out sensitive-value-1"; done`)
+		done <- err
+	}()
+
+	// Then the command is stopped, and the error returned
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "write failed")
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return once the masked output could not be written")
+	}
+}
+
+func TestExecutor_Run_RunsUnderTerminal(t *testing.T) {
+	// Given
+	ctx := NewDefaultMaskOpts()
+	e, stdout, _ := testExecutor(ctx, "")
+
+	// When
+	code, err := e.Run("sh", "-c", `test -t 0 && test -t 1 && test -t 2 && echo terminal`)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "terminal\r\n", stdout.String())
+}
+
+func TestExecutor_Run_ForwardsStdinAndMasksPrompt(t *testing.T) {
+	// Given a command prompting for input (without a newline), and
+	// then exposing a previous value
+	ctx := NewDefaultMaskOpts()
+	e, stdout, _ := testExecutor(ctx, "yes\n")
+
+	// When
+	code, err := e.Run("sh", "-c", `printf "Enter a value: "; read v; `+
+		`echo "  ~ password = \"old-secret-DJSKH\" -> \"sensitive-value-1\" ($v)"`)
+
+	// Then (the piped input being echoed by the terminal)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Enter a value: ")
+	assert.Contains(t, stdout.String(), "  ~ password = \"******\" -> \"******\" (yes)\r\n")
+}
+
+func TestExecutor_Run_KilledBySignal(t *testing.T) {
+	// Given
+	ctx := NewDefaultMaskOpts()
+	e, _, _ := testExecutor(ctx, "")
+
+	// When
+	code, err := e.Run("sh", "-c", `kill -TERM $$`)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 143, code)
+}
+
+func TestExecutor_Run_UnknownCommand(t *testing.T) {
+	// Given
+	ctx := NewDefaultMaskOpts()
+	e, _, _ := testExecutor(ctx, "")
+
+	// When
+	_, err := e.Run("terrahelp-no-such-command")
+
+	// Then
+	assert.Error(t, err)
+}
+
+// promptWriter signals once the prompt has been written
+type promptWriter struct {
+	buf      bytes.Buffer
+	prompt   string
+	prompted chan bool
+}
+
+func (w *promptWriter) Write(b []byte) (int, error) {
+	n, err := w.buf.Write(b)
+	if w.prompted != nil && strings.Contains(w.buf.String(), w.prompt) {
+		close(w.prompted)
+		w.prompted = nil
+	}
+	return n, err
+}
+
+func TestExecutor_Run_PromptWrittenBeforeInput(t *testing.T) {
+	// Given input only provided once the prompt has been written
+	ctx := NewDefaultMaskOpts()
+	e, _, _ := testExecutor(ctx, "")
+	stdout := &promptWriter{prompt: "Enter a value: ", prompted: make(chan bool)}
+	prompted := stdout.prompted
+	in, w := io.Pipe()
+	e.stdin, e.stdout = in, stdout
+	go func() {
+		<-prompted
+		w.Write([]byte("yes\n"))
+		w.Close()
+	}()
+
+	// When
+	code, err := e.Run("sh", "-c", `printf "Enter a value: "; read v; echo "approved $v"`)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.buf.String(), "approved yes")
+}
+
+func TestExecutor_Run_TeeEncrypted(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := NewDefaultMaskOpts()
+	ctx.TeeEncryptedFilename = filepath.Join(dir, "apply.log.enc")
+	e, stdout, _ := testExecutor(ctx, "")
+	e.masker.WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When
+	code, err := e.Run("sh", "-c", `echo "out sensitive-value-1"; echo "err old-secret-DJSKH" >&2`)
+
+	// Then the output is masked, with encrypted copies of stdout and stderr each kept apart
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "out ******\r\n", stdout.String())
+	assert.Equal(t, "out sensitive-value-1\r\n", readTee(t, ctx.TeeEncryptedFilename))
+	assert.Equal(t, "err old-secret-DJSKH\r\n", readTee(t, ctx.TeeEncryptedFilename+".stderr"))
+}
+
+func TestExecutor_Run_TeeEncryptedCommandFails(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := NewDefaultMaskOpts()
+	ctx.TeeEncryptedFilename = filepath.Join(dir, "apply.log.enc")
+	e, stdout, _ := testExecutor(ctx, "")
+	e.masker.WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When the command fails
+	code, err := e.Run("sh", "-c", `echo "out sensitive-value-1"; exit 3`)
+
+	// Then the encrypted copy of its output is still written
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "out ******\r\n", stdout.String())
+	assert.Equal(t, "out sensitive-value-1\r\n", readTee(t, ctx.TeeEncryptedFilename))
+
+	// And it is written out even when the command can not be run
+	_, err = e.Run("terrahelp-no-such-command")
+	assert.Error(t, err)
+	assert.Equal(t, "", readTee(t, ctx.TeeEncryptedFilename))
+}
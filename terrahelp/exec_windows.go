@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package terrahelp
+
+import "fmt"
+
+func (e *Executor) run(name string, args ...string) (int, error) {
+	return 0, fmt.Errorf("exec is not supported on windows, pipe the output of %s into mask instead", name)
+}
@@ -0,0 +1,182 @@
+package terrahelp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// TfvarsHistory provides the previous values of the sensitive variables within
+// a tfvars file, as held in its backup file and/or its earlier git revisions,
+// so that rotated out secrets are also recognised as sensitive
+type TfvarsHistory struct {
+	tfvars    *Tfvars
+	bkpExt    string
+	revisions int
+	git       func(dir string, args ...string) ([]byte, error)
+}
+
+// NewTfvarsHistory creates a new TfvarsHistory for the Tfvars (whose selection
+// rules and decryption are also applied to the previous values). The backup
+// file (tfvars filename + bkpExt) is read if it exists and bkpExt is not empty,
+// along with the last revisions git revisions of the tfvars file.
+func NewTfvarsHistory(t *Tfvars, bkpExt string, revisions int) *TfvarsHistory {
+	return &TfvarsHistory{tfvars: t, bkpExt: bkpExt, revisions: revisions, git: runGit}
+}
+
+// Values returns the previous sensitive values of the tfvars file
+func (h *TfvarsHistory) Values() ([]string, error) {
+	svs, err := h.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns the previous sensitive values of the tfvars file, along
+// with the backup file or git revision and variable each one came from
+func (h *TfvarsHistory) SourcedValues() ([]SourcedValue, error) {
+	var svs []SourcedValue
+	if h.bkpExt != "" {
+		bkp := h.tfvars.filename + h.bkpExt
+		b, err := ioutil.ReadFile(bkp)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			found, err := h.previousValues(b, bkp, "tfvars:"+bkp)
+			if err != nil {
+				return nil, err
+			}
+			svs = append(svs, found...)
+		}
+	}
+
+	if h.revisions > 0 {
+		found, err := h.gitValues()
+		if err != nil {
+			return nil, err
+		}
+		svs = append(svs, found...)
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// gitValues returns the sensitive values held in the last revisions
+// git revisions of the tfvars file
+func (h *TfvarsHistory) gitValues() ([]SourcedValue, error) {
+	dir, base := filepath.Split(h.tfvars.filename)
+	if dir == "" {
+		dir = "."
+	}
+	out, err := h.git(dir, "log", fmt.Sprintf("-n%d", h.revisions), "--format=%H", "--", base)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the git history of %s : %s", h.tfvars.filename, err)
+	}
+
+	var svs []SourcedValue
+	for _, rev := range strings.Fields(string(out)) {
+		b, err := h.git(dir, "show", rev+":./"+base)
+		if err != nil {
+			// The file did not exist (e.g. was deleted) in this revision
+			continue
+		}
+		name := fmt.Sprintf("%s@%.8s", h.tfvars.filename, rev)
+		found, err := h.previousValues(b, name, "git:"+name)
+		if err != nil {
+			return nil, err
+		}
+		svs = append(svs, found...)
+	}
+	return svs, nil
+}
+
+// previousValues returns the sensitive values held within the previous
+// (named) content of the tfvars file, recorded as coming from the source
+func (h *TfvarsHistory) previousValues(b []byte, name, source string) ([]SourcedValue, error) {
+	prev := *h.tfvars
+	prev.filename = name
+	vars, err := prev.parseVariables(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var svs []SourcedValue
+	for _, tv := range vars {
+		for _, v := range tv.vals {
+			svs = append(svs, SourcedValue{Value: v, Source: source, Variable: "var." + tv.name})
+		}
+	}
+	return svs, nil
+}
+
+// TfstateHistory provides the values of the sensitive outputs and resource
+// attributes held within the earlier serials of a tfstate file, being the
+// terraform backup of it and the (possibly encrypted) terrahelp backups
+// of both, which are discovered alongside it
+type TfstateHistory struct {
+	filename  string
+	bkpExt    string
+	encrypter Encrypter
+	key       string
+}
+
+// NewTfstateHistory creates a new TfstateHistory for the tfstate file. Its terraform
+// backup (tfstate filename + .backup) is read if it exists, along with the terrahelp
+// backups (+ bkpExt) of the tfstate file and of its terraform backup, when bkpExt is
+// not empty.
+func NewTfstateHistory(f, bkpExt string) *TfstateHistory {
+	return &TfstateHistory{filename: f, bkpExt: bkpExt}
+}
+
+// WithDecryption configures the TfstateHistory to transparently decrypt (in memory
+// only) fully or inline encrypted earlier tfstate files, using the Encrypter and key
+func (h *TfstateHistory) WithDecryption(e Encrypter, key string) *TfstateHistory {
+	h.encrypter = e
+	h.key = key
+	return h
+}
+
+// Values returns the sensitive values of the earlier tfstate files
+func (h *TfstateHistory) Values() ([]string, error) {
+	svs, err := h.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns the sensitive values of the earlier tfstate files,
+// along with the file and output or resource attribute each one came from
+func (h *TfstateHistory) SourcedValues() ([]SourcedValue, error) {
+	var svs []SourcedValue
+	for _, f := range h.filenames() {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			continue
+		}
+		found, err := NewTfstateOutputsReplaceables(f).WithDecryption(h.encrypter, h.key).
+			WithSensitiveAttributes().SourcedValues()
+		if err != nil {
+			return nil, err
+		}
+		svs = append(svs, found...)
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// filenames returns the names of the files which may hold
+// earlier serials of the tfstate file
+func (h *TfstateHistory) filenames() []string {
+	// As per terraform, whose default backup is terraform.tfstate.backup
+	bkp := h.filename + ".backup"
+	if h.bkpExt == "" {
+		return []string{bkp}
+	}
+	return []string{bkp, h.filename + h.bkpExt, bkp + h.bkpExt}
+}
+
+// runGit runs the git CLI within the directory
+func runGit(dir string, args ...string) ([]byte, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(ee.Stderr)))
+	}
+	return out, err
+}
@@ -0,0 +1,171 @@
+package terrahelp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestTfvars(t *testing.T, f, password string) {
+	content := fmt.Sprintf("db_username = \"admin\"\ndb_password = \"%s\"\n", password)
+	if err := ioutil.WriteFile(f, []byte(content), 0600); err != nil {
+		t.Fatalf("Unable to write test tfvars : %s", err)
+	}
+}
+
+func TestTfvarsHistory_SourcedValues_Backup(t *testing.T) {
+	// Given a tfvars file along with its backup holding a previous password
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := path.Join(dir, "terraform.tfvars")
+	writeTestTfvars(t, f, "current-password-SKDJH")
+	writeTestTfvars(t, f+ThBkpExtension, "previous-password-DJSKH")
+	h := NewTfvarsHistory(NewTfVars(f, true), ThBkpExtension, 0)
+
+	// When
+	svs, err := h.SourcedValues()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "previous-password-DJSKH", Source: "tfvars:" + f + ThBkpExtension, Variable: "var.db_password"},
+		{Value: "admin", Source: "tfvars:" + f + ThBkpExtension, Variable: "var.db_username"},
+	}, svs)
+}
+
+func TestTfvarsHistory_Values_NoBackup(t *testing.T) {
+	// Given
+	h := NewTfvarsHistory(NewTfVars(exampleTestTfvars, true), ".does-not-exist", 0)
+
+	// When
+	vals, err := h.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, vals)
+}
+
+func TestTfvarsHistory_SourcedValues_Git(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// Given a tfvars file which has been committed (encrypted) three times
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	git := func(args ...string) {
+		args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed : %s", args, out)
+		}
+	}
+	git("init", "-q")
+	f := path.Join(dir, "terraform.tfvars")
+	e := NewSimpleEncrypter()
+	for _, pw := range []string{"oldest-password-KDJSH", "older-password-SJDKH", "current-password-SKDJH"} {
+		writeTestTfvars(t, f, pw)
+		b, err := ioutil.ReadFile(f)
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(f, mustEncrypt(t, e, testSimpleKey, string(b)), 0600))
+		git("add", "terraform.tfvars")
+		git("commit", "-q", "-m", pw)
+	}
+	h := NewTfvarsHistory(NewTfVars(f, true).WithDecryption(e, testSimpleKey), "", 2)
+
+	// When
+	vals, err := h.Values()
+
+	// Then only the last two revisions are considered
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"current-password-SKDJH", "older-password-SJDKH", "admin"}, vals)
+}
+
+func TestTfvarsHistory_Values_GitError(t *testing.T) {
+	// Given
+	h := NewTfvarsHistory(NewTfVars(exampleTestTfvars, true), "", 3)
+	h.git = func(dir string, args ...string) ([]byte, error) {
+		return nil, fmt.Errorf("not a git repository")
+	}
+
+	// When
+	_, err := h.Values()
+
+	// Then
+	assert.EqualError(t, err, "Unable to read the git history of test-data/example-project/original/terraform.tfvars : not a git repository")
+}
+
+func writeTestTfstate(t *testing.T, f, password string) []byte {
+	content := fmt.Sprintf(`{"version": 4, "serial": 1, "outputs": {"db_password": {"sensitive": true, "value": "%s"}}}`, password)
+	if err := ioutil.WriteFile(f, []byte(content), 0600); err != nil {
+		t.Fatalf("Unable to write test tfstate : %s", err)
+	}
+	return []byte(content)
+}
+
+func TestTfstateHistory_SourcedValues(t *testing.T) {
+	// Given a tfstate file along with its terraform backup, and an
+	// encrypted terrahelp backup of the terraform backup
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := path.Join(dir, TfstateFilename)
+	writeTestTfstate(t, f, "current-password-SKDJH")
+	writeTestTfstate(t, f+".backup", "previous-password-DJSKH")
+	e := NewSimpleEncrypter()
+	b := writeTestTfstate(t, f+".backup"+ThBkpExtension, "oldest-password-KDJSH")
+	assert.NoError(t, ioutil.WriteFile(f+".backup"+ThBkpExtension, mustEncrypt(t, e, testSimpleKey, string(b)), 0600))
+	h := NewTfstateHistory(f, ThBkpExtension).WithDecryption(e, testSimpleKey)
+
+	// When
+	svs, err := h.SourcedValues()
+
+	// Then the earlier serials are discovered, and decrypted where required
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "previous-password-DJSKH", Source: "tfstate:" + f + ".backup", Variable: "output.db_password"},
+		{Value: "oldest-password-KDJSH", Source: "tfstate:" + f + ".backup" + ThBkpExtension, Variable: "output.db_password"},
+	}, svs)
+
+	// And an encryption provider is required to read the encrypted backup
+	_, err = NewTfstateHistory(f, ThBkpExtension).Values()
+	assert.EqualError(t, err, f+".backup"+ThBkpExtension+" is encrypted, an encryption provider is required to decrypt it")
+}
+
+func TestTfstateHistory_Values_NoBackups(t *testing.T) {
+	// Given
+	h := NewTfstateHistory("test-data/sources/terraform.tfstate", ThBkpExtension)
+
+	// When
+	vals, err := h.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, vals)
+}
+
+func TestMasker_Mask_RotatedSecretFromHistory(t *testing.T) {
+	// Given a secret which has been rotated, whose previous value is held in the backup
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := path.Join(dir, "terraform.tfvars")
+	writeTestTfvars(t, f, "current-password-SKDJH")
+	writeTestTfvars(t, f+ThBkpExtension, "previous-password-DJSKH")
+	tfv := NewTfVars(f, true)
+	ctx := NewDefaultMaskOpts()
+	m := NewMasker(ctx, NewCompositeReplaceables(tfv, NewTfvarsHistory(tfv, ThBkpExtension, 0)))
+
+	// When
+	actual, err := m.maskBytes([]byte("connect using previous-password-DJSKH or current-password-SKDJH\n"))
+
+	// Then the rotated out secret is masked wherever it appears
+	assert.NoError(t, err)
+	assert.Equal(t, "connect using ****** or ******\n", string(actual))
+}
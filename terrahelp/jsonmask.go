@@ -0,0 +1,249 @@
+package terrahelp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/acarl005/stripansi"
+)
+
+// Supported mask formats, determining how the content being masked is treated
+const (
+	// MaskFormatText treats the content as text
+	MaskFormatText = "text"
+	// MaskFormatJSON treats the content as JSON documents, or JSON lines (e.g. the
+	// output of terraform plan -json), masking the decoded string values within them
+	// and re-encoding them, so the content remains valid JSON. Any content which is
+	// not JSON is treated as text.
+	MaskFormatJSON = "json"
+	// MaskFormatPlan treats the content as a terraform plan file, giving a
+	// sanitised copy of it, with the sensitive values within each of its
+	// members masked (see Masker.maskPlan)
+	MaskFormatPlan = "plan"
+)
+
+func (m *MaskOpts) validateFormat() error {
+	switch m.Format {
+	case "", MaskFormatText, MaskFormatJSON, MaskFormatPlan:
+		return nil
+	}
+	return fmt.Errorf("Unknown mask format %s specified", m.Format)
+}
+
+// jsonScanner tracks, line by line, where each JSON document ends
+type jsonScanner struct {
+	depth    int
+	inString bool
+	escaped  bool
+	started  bool
+}
+
+// scanLine scans the next line of a JSON document, returning
+// true should the document be complete at the end of it
+func (s *jsonScanner) scanLine(line string) bool {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.inString:
+			if s.escaped {
+				s.escaped = false
+			} else if c == '\\' {
+				s.escaped = true
+			} else if c == '"' {
+				s.inString = false
+			}
+		case c == '"':
+			s.inString, s.started = true, true
+		case c == '{' || c == '[':
+			s.depth++
+			s.started = true
+		case c == '}' || c == ']':
+			s.depth--
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		default:
+			s.started = true
+		}
+	}
+	return s.started && s.depth <= 0 && !s.inString
+}
+
+// jsonStart returns true if the line could start a JSON document
+func jsonStart(line string) bool {
+	t := strings.TrimSpace(line)
+	return t == "" || strings.IndexByte(`{["-0123456789tfn`, t[0]) >= 0
+}
+
+// jsonSegmentEnd returns where the segment of data ready to be masked
+// ends, i.e. after its last whole line, JSON documents never being split
+func jsonSegmentEnd(data string, eof bool) int {
+	if eof {
+		return len(data)
+	}
+	return strings.LastIndexByte(data, '\n') + 1
+}
+
+func (m *Masker) maskJSONStream(item string, in io.Reader, out io.Writer) error {
+	f, counts, err := m.jsonTransform(item)
+	if err != nil {
+		return err
+	}
+	err = transformSegments(in, out, jsonSegmentEnd, f)
+	m.ctx.logReplacements("masked", counts)
+	return err
+}
+
+func (m *Masker) maskJSONBytes(plain []byte) ([]byte, error) {
+	f, counts, err := m.jsonTransform(m.item)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := f(string(plain), true)
+	m.ctx.logReplacements("masked", counts)
+	return []byte(out), err
+}
+
+// jsonTransform returns the transform masking each segment (of whole lines) of the
+// content in turn, any incomplete JSON document being carried over to the next
+func (m *Masker) jsonTransform(item string) (segmentTransform, map[string]int, error) {
+	sensitiveVals, err := m.sensitiveValues("")
+	if err != nil {
+		return nil, nil, err
+	}
+	r := NewReplacer(values(sensitiveVals))
+	counts := map[string]int{}
+
+	sc := &jsonScanner{}
+	// scanned is how much of the carried over document has been scanned
+	scanned := 0
+	line := 1
+	f := func(seg string, final bool) (string, string, error) {
+		var sb strings.Builder
+		start, pos := 0, scanned
+		for pos < len(seg) {
+			end := strings.IndexByte(seg[pos:], '\n') + pos + 1
+			if end == pos {
+				end = len(seg)
+			}
+			l := seg[pos:end]
+			complete := false
+			if start == pos && !sc.started && !jsonStart(l) {
+				complete = true
+			} else {
+				complete = sc.scanLine(l)
+			}
+			pos = end
+			if !complete && !(final && pos == len(seg)) {
+				continue
+			}
+
+			doc := seg[start:end]
+			out, err := m.maskJSONDocument(item, doc, line, r, sensitiveVals, counts)
+			if err != nil {
+				return "", "", err
+			}
+			sb.WriteString(out)
+			line += strings.Count(doc, "\n")
+			start = end
+			*sc = jsonScanner{}
+		}
+		scanned = pos - start
+		return sb.String(), seg[start:], nil
+	}
+	return f, counts, nil
+}
+
+// maskJSONDocument masks the string values (and object keys if configured) within the
+// JSON document, which begins on the line, or should it not be JSON, the text
+func (m *Masker) maskJSONDocument(item, doc string, line int, r *Replacer, svs []SourcedValue, counts map[string]int) (string, error) {
+	if strings.TrimSpace(doc) == "" {
+		return doc, nil
+	}
+	if !json.Valid([]byte(doc)) {
+		lc := &lineCounter{}
+		lc.reset(stripansi.Strip(doc), line)
+		text, err := ansiReplace(r, doc, m.replacement(item, svs, counts, lc.at))
+		if err == nil && !m.streamable() {
+			text, err = m.maskDetected(item, text, line, counts)
+		}
+		return text, err
+	}
+
+	var sb strings.Builder
+	lc := &lineCounter{}
+	lc.reset(doc, line)
+	last := 0
+	for i := 0; i < len(doc); i++ {
+		if doc[i] != '"' {
+			continue
+		}
+		j := jsonStringEnd(doc, i)
+		if !m.ctx.MaskKeys && jsonKey(doc, j) {
+			i = j - 1
+			continue
+		}
+		var v string
+		if err := json.Unmarshal([]byte(doc[i:j]), &v); err != nil {
+			return "", err
+		}
+		masked, err := m.maskJSONString(item, v, lc.at(i), r, svs, counts)
+		if err != nil {
+			return "", err
+		}
+		if masked != v {
+			sb.WriteString(doc[last:i])
+			sb.WriteString(encodeJSONString(masked))
+			last = j
+		}
+		i = j - 1
+	}
+	sb.WriteString(doc[last:])
+	return sb.String(), nil
+}
+
+// maskJSONString masks the known, and any detected, values within the string value
+func (m *Masker) maskJSONString(item, v string, line int, r *Replacer, svs []SourcedValue, counts map[string]int) (string, error) {
+	onLine := func(int) int { return line }
+	v, _, err := r.replacePrefix(v, true, m.replacement(item, svs, counts, onLine))
+	if err != nil || len(m.detectors()) == 0 {
+		return v, err
+	}
+	dets, err := detectValues(m.detectors(), v)
+	if err != nil || len(dets) == 0 {
+		return v, err
+	}
+	detected := mergeDetectedValues(nil, dets)
+	v, _, err = NewReplacer(values(detected)).replacePrefix(v, true, m.replacement(item, detected, counts, onLine))
+	return v, err
+}
+
+// jsonStringEnd returns the end of the JSON string starting at i
+func jsonStringEnd(doc string, i int) int {
+	for j := i + 1; j < len(doc); j++ {
+		switch doc[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(doc)
+}
+
+// jsonKey returns true if the JSON string ending at j is an object key
+func jsonKey(doc string, j int) bool {
+	rest := strings.TrimLeft(doc[j:], " \t\r\n")
+	return strings.HasPrefix(rest, ":")
+}
+
+// encodeJSONString encodes the string as JSON, without escaping HTML characters
+// (e.g. the < and > within named masks) as there is no need to
+func encodeJSONString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,149 @@
+package terrahelp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonTestTfvars holds values which are escaped when encoded as JSON
+const jsonTestTfvars = `db_password = "quote\"and\\back"
+api_key     = "p<ss>word-GHDKS"
+plain       = "madeup-aws-secret-key-KGSDGH"
+`
+
+const jsonTestLines = `{"@level":"info","@message":"Plan: 1 to add","type":"version"}
+{"@level":"info","@message":"aws_db_instance.db: password=\"quote\\\"and\\\\back\"","change":{"password":"quote\"and\\back"}}
+{"@level":"info","hook":{"api_key":"p<ss>word-GHDKS","madeup-aws-secret-key-KGSDGH":"madeup-aws-secret-key-KGSDGH"}}
+`
+
+func jsonTestMasker(t *testing.T) (*Masker, func()) {
+	dir, err := ioutil.TempDir("", "terrahelp-jsonmask")
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "terraform.tfvars")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(jsonTestTfvars), 0600))
+	return defaultTestMasker(file, jsonTestOpts), func() { os.RemoveAll(dir) }
+}
+
+func jsonTestOpts(ctx *MaskOpts) {
+	ctx.Format = MaskFormatJSON
+}
+
+func TestMasker_maskJSONBytes(t *testing.T) {
+	// Given
+	m, cleanup := jsonTestMasker(t)
+	defer cleanup()
+
+	// When
+	out, err := m.maskBytes([]byte(jsonTestLines))
+
+	// Then the escaped values are masked, each line remaining valid JSON, with keys left alone
+	assert.NoError(t, err)
+	assert.Equal(t, `{"@level":"info","@message":"Plan: 1 to add","type":"version"}
+{"@level":"info","@message":"aws_db_instance.db: password=\"******\"","change":{"password":"******"}}
+{"@level":"info","hook":{"api_key":"******","madeup-aws-secret-key-KGSDGH":"******"}}
+`, string(out))
+	for _, l := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		assert.True(t, json.Valid([]byte(l)), l)
+	}
+}
+
+func TestMasker_maskJSONBytes_MaskKeys(t *testing.T) {
+	// Given
+	m, cleanup := jsonTestMasker(t)
+	defer cleanup()
+	m.ctx.MaskKeys = true
+
+	// When
+	out, err := m.maskBytes([]byte(jsonTestLines))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"hook":{"api_key":"******","******":"******"}}`)
+}
+
+func TestMasker_maskJSONBytes_NamedMasks(t *testing.T) {
+	// Given
+	m, cleanup := jsonTestMasker(t)
+	defer cleanup()
+	m.ctx.NamedMasks = true
+
+	// When
+	out, err := m.maskBytes([]byte(jsonTestLines))
+
+	// Then the named masks are not HTML escaped
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"change":{"password":"<sensitive:var.db_password>"}}`)
+}
+
+func TestMasker_maskJSONBytes_Document(t *testing.T) {
+	// Given a pretty printed document, followed by some text
+	m, cleanup := jsonTestMasker(t)
+	defer cleanup()
+	doc := `{
+  "outputs": {
+    "password": {
+      "sensitive": true,
+      "value": "quote\"and\\back"
+    }
+  },
+  "list": [ "p<ss>word-GHDKS", 1, null ]
+}
+Error: invalid value "p<ss>word-GHDKS"
+`
+
+	// When
+	out, err := m.maskBytes([]byte(doc))
+
+	// Then the formatting is untouched, and the text is masked as text
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "outputs": {
+    "password": {
+      "sensitive": true,
+      "value": "******"
+    }
+  },
+  "list": [ "******", 1, null ]
+}
+Error: invalid value "******"
+`, string(out))
+	assert.Equal(t, 3, m.Report().Total)
+	assert.Equal(t, []int{5}, m.Report().sorted()[1].Lines)
+}
+
+func TestMasker_maskJSONStream(t *testing.T) {
+	// Given JSON lines, some text, then a document lacking a trailing newline
+	expected, cleanup := jsonTestMasker(t)
+	defer cleanup()
+	content := jsonTestLines + `not json "madeup-aws-secret-key-KGSDGH"
+{
+  "a": "quote\"and\\back"
+}`
+	expectedOut, err := expected.maskBytes([]byte(content))
+	assert.NoError(t, err)
+	m := defaultTestMasker(expected.replacables.(*Tfvars).filename, jsonTestOpts)
+
+	// When the content is streamed one byte at a time
+	var out bytes.Buffer
+	err = m.maskStream(iotest.OneByteReader(strings.NewReader(content)), &out)
+
+	// Then the result is the same as when masked all at once
+	assert.NoError(t, err)
+	assert.Equal(t, string(expectedOut), out.String())
+	assert.Equal(t, expected.Report(), m.Report())
+	assert.NotContains(t, out.String(), "back")
+}
+
+func TestMaskOpts_validateFormat(t *testing.T) {
+	assert.NoError(t, (&MaskOpts{Format: MaskFormatJSON}).validateFormat())
+	assert.NoError(t, (&MaskOpts{}).validateFormat())
+	assert.Error(t, (&MaskOpts{Format: "yaml"}).validateFormat())
+}
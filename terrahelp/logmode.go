@@ -0,0 +1,221 @@
+package terrahelp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Log mode detector rule IDs
+const (
+	LogRuleAuthHeader      = "log-auth-header"
+	LogRuleBasicAuth       = "log-basic-auth"
+	LogRuleCredentialField = "log-credential-field"
+	LogRuleFormCredential  = "log-form-credential"
+	LogRuleBodyField       = "log-body-field"
+)
+
+// credentialFieldName matches the names of fields (and form parameters) known to
+// hold credentials, e.g. password, db_password, client_secret or access_token
+const credentialFieldName = `[\w.-]*?(?:password|passwd|secret|token|api_?key|private_?key|credentials?)`
+
+// LogDetectorRules returns the rules applied in log mode (see MaskOpts.LogMode), which
+// detect the credentials exposed by the raw HTTP requests and responses logged by
+// providers when TF_LOG is set. The rules apply equally to the message of a log line,
+// the fields following it (e.g. tf_http_req_body="..."), the lines of an HTTP dump
+// following it, and to JSON log lines (TF_LOG=JSON) where the quotes are escaped.
+func LogDetectorRules() []*DetectorRule {
+	return []*DetectorRule{
+		{
+			ID:          LogRuleAuthHeader,
+			Description: "Authorization (excluding its scheme), cookie and API key / token headers",
+			Pattern: regexp.MustCompile(`(?i)\b(?:(?:proxy-)?authorization|cookie|set-cookie|x-api-key|api-key|x-auth-token|` +
+				`x-vault-token|x-consul-token|x-nomad-token|x-amz-security-token|x-goog-api-key|private-token)` +
+				`\\*"?\s*[:=]\s*\\*["']?(?:(?:bearer|basic|token|digest|negotiate|aws4-hmac-sha256)\s+)?` +
+				`([^\s"'\\](?:[^\r\n"'\\]*[^\s"'\\])?)`),
+			Group: 1,
+		},
+		{
+			ID:          LogRuleCredentialField,
+			Description: "Quoted values of credential fields, e.g. \"password\": \"...\" or client_secret=\"...\"",
+			Pattern:     regexp.MustCompile(`(?i)\b` + credentialFieldName + `\\*"?\s*[:=]\s*\\*"([^"\\]{4,})\\*"`),
+			Group:       1,
+		},
+		{
+			ID:          LogRuleFormCredential,
+			Description: "Values of credential parameters within form encoded bodies and query strings",
+			Pattern:     regexp.MustCompile(`(?im)(?:^|[?&\s"])` + credentialFieldName + `=([^&\s"'\\]{4,})`),
+			Group:       1,
+		},
+	}
+}
+
+var (
+	// credentialKeyRegExp matches the (whole) name of a field known to hold credentials
+	credentialKeyRegExp = regexp.MustCompile(`(?i)^` + credentialFieldName + `$`)
+	// logQuotedFieldRegExp matches the (Go quoted) values of the fields following the
+	// message of a log line (e.g. tf_http_req_body="{\"password\":...}"), and those of
+	// protobuf text dumps of the gRPC requests and responses (e.g. json:"{...}")
+	logQuotedFieldRegExp = regexp.MustCompile(`[\w@.-]+[=:]\s?("(?:[^"\\\r\n]|\\.)*")`)
+)
+
+var basicAuthRegExp = regexp.MustCompile(`(?i)\b(?:proxy-)?authorization\\*"?\s*[:=]\s*\\*["']?basic\s+([A-Za-z0-9+/]+=*)`)
+
+// LogDetector detects the credentials found within terraform (provider) debug logs
+type LogDetector struct {
+	rules *RuleDetector
+}
+
+// NewLogDetector creates a new LogDetector applying the LogDetectorRules
+func NewLogDetector() *LogDetector {
+	return &LogDetector{rules: NewRuleDetector(LogDetectorRules())}
+}
+
+// Detect returns the credentials found within the log content, which in addition
+// to those matched by the rules includes the password within any basic auth
+// header, so it is masked wherever else it appears in its decoded form, and the
+// values of the credential fields within the (JSON) bodies and gRPC dumps logged
+func (d *LogDetector) Detect(content string) ([]Detection, error) {
+	dets, err := d.rules.Detect(content)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, det := range dets {
+		seen[det.Value] = true
+	}
+	for _, v := range logBodyCredentials(content) {
+		if !seen[v] {
+			seen[v] = true
+			dets = append(dets, Detection{RuleID: LogRuleBodyField, Value: v})
+		}
+	}
+	for _, m := range basicAuthRegExp.FindAllStringSubmatch(content, -1) {
+		b, err := base64.StdEncoding.DecodeString(m[1])
+		if err != nil {
+			continue
+		}
+		if i := strings.IndexByte(string(b), ':'); i >= 0 && i < len(b)-1 {
+			dets = append(dets, Detection{RuleID: LogRuleBasicAuth, Value: string(b[i+1:])})
+		}
+	}
+	return dets, nil
+}
+
+// logDetector is the detector used by all Maskers in log mode
+var logDetector = NewLogDetector()
+
+// logBodyCredentials returns the values of the credential fields found within the
+// structure of the log, i.e. within JSON log lines (TF_LOG=JSON), the JSON bodies
+// logged within messages (including HTTP dumps spanning several lines), and the
+// quoted values of the fields following the messages, such as the (escaped) HTTP
+// bodies, or the JSON and msgpack encoded values within the gRPC dumps
+func logBodyCredentials(content string) []string {
+	var vals []string
+	collect := func(v string) { vals = append(vals, v) }
+	walkJSONBodies(content, collect)
+	for _, m := range logQuotedFieldRegExp.FindAllStringSubmatch(content, -1) {
+		v, err := strconv.Unquote(m[1])
+		if err != nil {
+			continue
+		}
+		// The values are found unquoted, so are also collected as they appear quoted
+		quoted := func(v string) {
+			collect(v)
+			collect(strings.TrimSuffix(strings.TrimPrefix(strconv.Quote(v), `"`), `"`))
+		}
+		walkJSONBodies(v, quoted)
+		walkMsgpackFields(v, quoted)
+	}
+	return vals
+}
+
+// walkJSONBodies calls f with the value of each credential field found within
+// the JSON objects (and arrays) held within the text
+func walkJSONBodies(text string, f func(string)) {
+	for i := 0; i < len(text); i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(text[i:]))
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			continue
+		}
+		walkJSONValue("", v, f)
+		i += int(dec.InputOffset()) - 1
+	}
+}
+
+// walkJSONValue calls f with the value of each credential field within the
+// JSON value (held by the key), including within any JSON encoded strings
+func walkJSONValue(key string, v interface{}, f func(string)) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, c := range t {
+			walkJSONValue(k, c, f)
+		}
+	case []interface{}:
+		for _, c := range t {
+			walkJSONValue(key, c, f)
+		}
+	case string:
+		if len(t) >= 4 && credentialKeyRegExp.MatchString(key) {
+			f(t)
+		}
+		if s := strings.TrimSpace(t); strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+			// The values are found within the decoded string, so are also
+			// collected as they appear within it when JSON escaped
+			walkJSONBodies(s, func(v string) {
+				f(v)
+				f(jsonEscape(v, true))
+				f(jsonEscape(v, false))
+			})
+		}
+	}
+}
+
+// walkMsgpackFields calls f with the value of each credential field within
+// msgpack encoded content (as provider values are passed over gRPC), being
+// any string following a string naming a credential field
+func walkMsgpackFields(b string, f func(string)) {
+	key := ""
+	for i := 0; i < len(b); {
+		s, n := msgpackString(b[i:])
+		if n == 0 {
+			key = ""
+			i++
+			continue
+		}
+		if len(s) >= 4 && credentialKeyRegExp.MatchString(key) {
+			f(s)
+		}
+		key = s
+		i += n
+	}
+}
+
+// msgpackString returns the (fixstr, str8 or str16) string at the start of b,
+// along with its encoded length, which is 0 if there is none
+func msgpackString(b string) (string, int) {
+	if len(b) == 0 {
+		return "", 0
+	}
+	l, h := 0, 0
+	switch c := b[0]; {
+	case c >= 0xa0 && c <= 0xbf:
+		l, h = int(c&0x1f), 1
+	case c == 0xd9 && len(b) >= 2:
+		l, h = int(b[1]), 2
+	case c == 0xda && len(b) >= 3:
+		l, h = int(b[1])<<8|int(b[2]), 3
+	default:
+		return "", 0
+	}
+	if h+l > len(b) {
+		return "", 0
+	}
+	return b[h : h+l], h + l
+}
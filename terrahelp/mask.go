@@ -1,10 +1,15 @@
 package terrahelp
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
-	"regexp"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/acarl005/stripansi"
 )
@@ -14,6 +19,16 @@ import (
 type Masker struct {
 	ctx         *MaskOpts
 	replacables Replaceables
+	encrypter   Encrypter
+	key         string
+	tokens      *tokenizer
+	report      *MaskReport
+	item        string
+	stderr      io.Writer
+	tees        map[string]*teeFile
+	teeFilename string
+	// mu guards the report and tokens when masking concurrently
+	mu sync.Mutex
 }
 
 // NewMasker creates a new NewMasker with the specified options
@@ -22,17 +37,67 @@ func NewMasker(ctx *MaskOpts, svh Replaceables) *Masker {
 	if svh == nil {
 		svh = &DefaultReplaceables{Vals: []string{}}
 	}
-	return &Masker{ctx: ctx, replacables: svh}
+	return &Masker{ctx: ctx, replacables: svh, report: &MaskReport{}, item: "stdin", stderr: os.Stderr}
+}
+
+// WithEncryption sets the Encrypter (and key) used to encrypt
+// the token mapping written when tokenizing
+func (m *Masker) WithEncryption(e Encrypter, key string) *Masker {
+	m.encrypter = e
+	m.key = key
+	return m
 }
 
 // MaskOpts holds the specific options detailing how, and on what
 // to perform the masking action.
 type MaskOpts struct {
 	*TransformOpts
-	MaskChar              string
-	MaskNumChar           int
+	ProviderOpts
+	MaskChar    string
+	MaskNumChar int
+	// MaskStrategy determines how each value is masked (see MaskStrategies),
+	// MaskReveal being the number of characters revealed by MaskStrategyPartial
+	// and FingerprintKey the key used by MaskStrategyFingerprint
+	MaskStrategy   string
+	MaskReveal     int
+	FingerprintKey string
+	// NamedMasks renders each mask with MaskTemplate, revealing the name
+	// of the variable (or detector rule) each masked value came from
+	NamedMasks            bool
+	MaskTemplate          string
 	ReplacePrevVals       bool
 	ExcludeWhitespaceOnly bool
+	// StripColors removes ANSI escape sequences (colours) from the output,
+	// otherwise they are kept, even when found within a sensitive value
+	StripColors bool
+	// Dialect is the terraform output dialect (see OutputDialects) whose
+	// previous value patterns are applied, DialectAuto detects it
+	Dialect string
+	// PrevPatterns are user defined previous value patterns, applied
+	// in addition to those of the dialect
+	PrevPatterns []*PrevValuePattern
+	// Tokenize replaces each value with a unique token instead of a mask,
+	// writing the (encrypted) token mapping to TokenMapFilename so the
+	// content can later be restored by an Unmasker
+	Tokenize         bool
+	TokenMapFilename string
+	// Report writes a summary of what was masked (without the values) to
+	// stderr, and/or as JSON to ReportFilename. FailOnDetect fails the masking
+	// (once done) with ErrSensitiveDataMasked should anything have been masked.
+	Report         bool
+	ReportFilename string
+	FailOnDetect   bool
+	// Format is how the content is treated (see MaskFormatText and MaskFormatJSON),
+	// MaskKeys additionally masking the keys of JSON objects
+	Format   string
+	MaskKeys bool
+	// LogMode masks terraform debug logs (TF_LOG), additionally detecting the
+	// credentials within the logged HTTP requests and responses (see
+	// LogDetectorRules) along with the encoded variants of every value
+	LogMode bool
+	// TeeEncryptedFilename if set, is the file a copy of the raw (unmasked)
+	// content is written to, encrypted in full, so it can be archived
+	TeeEncryptedFilename string
 }
 
 func (m *MaskOpts) getMask() string {
@@ -43,10 +108,16 @@ func (m *MaskOpts) getMask() string {
 // default values set
 func NewDefaultMaskOpts() *MaskOpts {
 	return &MaskOpts{
-		TransformOpts:   &TransformOpts{TfvarsFilename: TfvarsFilename},
-		MaskChar:        MaskChar,
-		MaskNumChar:     NumberOfMaskChar,
-		ReplacePrevVals: true,
+		TransformOpts:    &TransformOpts{TfvarsFilename: TfvarsFilename, EncodedVariants: true},
+		MaskChar:         MaskChar,
+		MaskNumChar:      NumberOfMaskChar,
+		MaskStrategy:     MaskStrategyFixed,
+		MaskReveal:       NumberOfRevealedChar,
+		MaskTemplate:     DefaultMaskTemplate,
+		TokenMapFilename: DefaultTokenMapFilename,
+		ReplacePrevVals:  true,
+		Dialect:          DialectAuto,
+		Format:           MaskFormatText,
 	}
 }
 
@@ -55,6 +126,8 @@ const (
 	MaskChar         = "*"
 	NumberOfMaskChar = 6
 
+	// PrevVal2CurrentValSelectPattern is superseded by the
+	// patterns of the OutputDialects and no longer used
 	PrevVal2CurrentValSelectPattern = "(=\\s*|:\\s*)(\".+\")\\s*(=|-)>\\s*\"(\\%s*)\""
 	PrevVal2MaskedValReplacePattern = "\"%s\""
 )
@@ -74,14 +147,103 @@ func (m *Masker) Mask() error {
 		}
 	}
 
+	if err := m.start(); err != nil {
+		return err
+	}
+	// Close the encrypted copy should masking fail, keeping what has been read
+	defer m.closeTee()
 	for _, ci := range m.ctx.TransformItems {
 		if err := m.mask(ci); err != nil {
 			return err
 		}
 	}
+	return m.finish()
+}
+
+// start validates the mask options, setting up the tokenizer if tokenizing,
+// and the raw copy of the content if teeing
+func (m *Masker) start() error {
+	if err := m.ctx.validateMaskStrategy(); err != nil {
+		return err
+	}
+	if err := m.ctx.validateFormat(); err != nil {
+		return err
+	}
+	if m.ctx.LogMode {
+		m.ctx.EncodedVariants = true
+	}
+	if m.ctx.Tokenize {
+		if m.encrypter == nil {
+			return fmt.Errorf("An encryption provider is required to tokenize, in order to encrypt the token mapping")
+		}
+		t, err := newTokenizer()
+		if err != nil {
+			return err
+		}
+		m.tokens = t
+	}
+	if m.ctx.TeeEncryptedFilename != "" {
+		if m.encrypter == nil {
+			return fmt.Errorf("An encryption provider is required to tee an encrypted copy of the content")
+		}
+		m.teeFilename = m.ctx.teeFilename(time.Now())
+		if err := m.openTee(""); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// finish closes the encrypted copy (if teeing), writes out the token mapping (if tokenizing) and
+// reports on what was masked, failing should anything have been masked when configured
+// to fail on detection
+func (m *Masker) finish() error {
+	if err := m.closeTee(); err != nil {
+		return err
+	}
+	if m.tokens != nil {
+		if err := m.tokens.write(m.ctx.TokenMapFilename, m.encrypter, m.key); err != nil {
+			return err
+		}
+	}
+	if m.ctx.Report {
+		if err := m.report.Write(m.stderr); err != nil {
+			return err
+		}
+	}
+	if m.ctx.ReportFilename != "" {
+		if err := m.report.WriteJSON(m.ctx.ReportFilename); err != nil {
+			return err
+		}
+	}
+	if m.ctx.FailOnDetect && m.report.Total > 0 {
+		return ErrSensitiveDataMasked
+	}
+	return nil
+}
+
+// Report returns the summary of what has been masked
+func (m *Masker) Report() *MaskReport {
+	return m.report
+}
+
+// maskFor returns the token for the sensitive value when tokenizing,
+// otherwise its mask
+func (m *Masker) maskFor(sv SourcedValue) (string, error) {
+	if m.tokens != nil {
+		return m.tokens.token(sv.Value), nil
+	}
+	return m.ctx.maskFor(sv)
+}
+
+// maskRegExp returns the regex matching a masked (or tokenized) value
+func (m *Masker) maskRegExp() string {
+	if m.tokens != nil {
+		return tokenRegExp
+	}
+	return m.ctx.maskRegExp()
+}
+
 func (m *Masker) mask(t Transformable) error {
 
 	// Do any pre transformation actions (e.g. backup)
@@ -90,9 +252,15 @@ func (m *Masker) mask(t Transformable) error {
 	if err != nil {
 		return err
 	}
+	m.item = itemName(t)
 
-	// Read, mask, then write out result
-	in, err := t.read()
+	// Mask the content as it is read where possible (which plan files,
+	// being zip archives, never are), otherwise read, mask, then write out result
+	if st, ok := t.(streamingTransformable); ok && m.ctx.Format != MaskFormatPlan && (m.streamable() || m.ctx.Format == MaskFormatJSON) {
+		in, out := st.stream()
+		return m.maskStream(m.teeReader("", in), out)
+	}
+	in, err := m.read(t)
 	if err != nil {
 		return err
 	}
@@ -104,32 +272,192 @@ func (m *Masker) mask(t Transformable) error {
 	return t.write(b)
 }
 
+// read reads all the content, keeping a raw copy of it when teeing. Piped content
+// is copied as it is read, so what was read is kept should reading it fail.
+func (m *Masker) read(t Transformable) ([]byte, error) {
+	if st, ok := t.(streamingTransformable); ok {
+		in, _ := st.stream()
+		return ioutil.ReadAll(m.teeReader("", in))
+	}
+	in, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(m.teeReader("", bytes.NewReader(in)))
+}
+
+// streamable returns true if masking content as it is read gives exactly the same
+// result as masking it all at once, which is not the case when detecting values
+// or previous values, as these may be found after an earlier occurrence
+func (m *Masker) streamable() bool {
+	return len(m.detectors()) == 0 && !m.ctx.ReplacePrevVals
+}
+
+// sensitiveValues returns the sensitive values to mask within the content
+func (m *Masker) sensitiveValues(content string) ([]SourcedValue, error) {
+	return m.ctx.sensitiveValuesDetectedBy(m.replacables, m.detectors(), content)
+}
+
+// detectors returns the detectors applied, which in log mode includes the log detector
+func (m *Masker) detectors() []Detector {
+	if m.ctx.LogMode {
+		return append([]Detector{logDetector}, m.ctx.Detectors...)
+	}
+	return m.ctx.Detectors
+}
+
+func (m *Masker) maskStream(in io.Reader, out io.Writer) error {
+	if m.ctx.Format == MaskFormatJSON {
+		return m.maskJSONStream(m.item, in, out)
+	}
+	return m.maskSegments(m.item, in, out, segmentEnd)
+}
+
+// maskLive masks the content as it is read, writing out each part of it (including
+// any partial line, such as an interactive prompt) as soon as it is known. Values,
+// and previous values, are detected within each part rather than the content as a
+// whole. It may be called concurrently, for different items.
+func (m *Masker) maskLive(item string, in io.Reader, out io.Writer) error {
+	if m.ctx.Format == MaskFormatJSON {
+		// JSON is masked a whole line at a time, so is never shown partially
+		return m.maskJSONStream(item, in, out)
+	}
+	return m.maskSegments(item, in, out, liveSegmentEnd)
+}
+
+func (m *Masker) maskSegments(item string, in io.Reader, out io.Writer, end func(string, bool) int) error {
+	sensitiveVals, err := m.sensitiveValues("")
+	if err != nil {
+		return err
+	}
+
+	r := NewReplacer(values(sensitiveVals))
+	counts := map[string]int{}
+	lc := &lineCounter{}
+	line := 1
+	err = transformSegments(in, out, end, func(seg string, final bool) (string, string, error) {
+		if m.ctx.StripColors {
+			seg = stripansi.Strip(seg)
+		}
+		lc.reset(stripansi.Strip(seg), line)
+		o, carry, err := ansiReplacePrefix(r, seg, final, m.replacement(item, sensitiveVals, counts, lc.at))
+		if err == nil && !m.streamable() {
+			o, err = m.maskDetected(item, o, line, counts)
+		}
+		line += strings.Count(seg[:len(seg)-len(carry)], "\n")
+		return o, carry, err
+	})
+	m.ctx.logReplacements("masked", counts)
+	return err
+}
+
+// replacement returns the function providing the mask for each occurrence of
+// the sensitive values, counting and reporting (on its line) each one masked
+func (m *Masker) replacement(item string, sensitiveVals []SourcedValue, counts map[string]int, line func(offset int) int) func(replacerMatch) (string, error) {
+	return func(rm replacerMatch) (string, error) {
+		sv := sensitiveVals[rm.value]
+		counts[sv.Name()]++
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.report.record(item, sv, line(rm.start))
+		if sv.replacement != "" {
+			return sv.replacement, nil
+		}
+		return m.maskFor(sv)
+	}
+}
+
 func (m *Masker) maskBytes(plain []byte) ([]byte, error) {
+	switch m.ctx.Format {
+	case MaskFormatJSON:
+		return m.maskJSONBytes(plain)
+	case MaskFormatPlan:
+		return m.maskPlan(plain)
+	}
+	text := string(plain)
+	if m.ctx.StripColors {
+		text = stripansi.Strip(text)
+	}
 
-	// Convert and strip out the ascii colours.
-	inlinedText := stripansi.Strip(string(plain))
-	sensitiveVals, err := m.replacables.Values()
+	// Values are matched against the visible text, ignoring the ascii colours
+	sensitiveVals, err := m.sensitiveValues(stripansi.Strip(text))
 	if err != nil {
 		return nil, err
 	}
-
-	for _, v := range sensitiveVals {
-		inlinedText = strings.Replace(inlinedText, v, m.ctx.getMask(), -1)
+	counts := map[string]int{}
+	lc := &lineCounter{}
+	lc.reset(stripansi.Strip(text), 1)
+	text, err = ansiReplace(NewReplacer(values(sensitiveVals)), text, m.replacement(m.item, sensitiveVals, counts, lc.at))
+	if err != nil {
+		return nil, err
 	}
+	m.ctx.logReplacements("masked", counts)
 
 	if m.ctx.ReplacePrevVals {
-		// Additionally there are some patterns (specifically when doing terraform plans
-		// and apply where previous sensitive values may also be exposed. We try to catch
-		// these too.
+		text, err = m.maskPrevValues(m.item, text, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(text), nil
+}
 
-		r := regexp.MustCompile(fmt.Sprintf(PrevVal2CurrentValSelectPattern, m.ctx.MaskChar))
-		groups := r.FindAllStringSubmatch(inlinedText, -1)
-		maskedReplaceVal := fmt.Sprintf(PrevVal2MaskedValReplacePattern, m.ctx.getMask())
+// maskDetected masks any values detected within the (already masked) text, along
+// with any previous values (if configured), the text beginning on the line
+func (m *Masker) maskDetected(item, text string, line int, counts map[string]int) (string, error) {
+	vis := stripansi.Strip(text)
+	dets, err := detectValues(m.detectors(), vis)
+	if err != nil {
+		return "", err
+	}
+	if len(dets) > 0 {
+		svs := mergeDetectedValues(nil, dets)
+		if m.ctx.EncodedVariants {
+			svs = withEncodedVariants(svs)
+		}
+		lc := &lineCounter{}
+		lc.reset(vis, line)
+		text, err = ansiReplace(NewReplacer(values(svs)), text, m.replacement(item, svs, counts, lc.at))
+		if err != nil {
+			return "", err
+		}
+	}
+	if m.ctx.ReplacePrevVals {
+		return m.maskPrevValues(item, text, line)
+	}
+	return text, nil
+}
 
-		for i := range groups {
-			previousSensitiveVal := groups[i][2]
-			inlinedText = strings.ReplaceAll(inlinedText, previousSensitiveVal, maskedReplaceVal)
+// maskPrevValues masks the previous values exposed within the (already masked)
+// text, the text beginning on the line. There are some patterns (specifically when
+// doing terraform plans and apply) where previous sensitive values may also be
+// exposed. We try to catch these too, using the patterns for the dialect of
+// terraform output.
+func (m *Masker) maskPrevValues(item, text string, line int) (string, error) {
+	pats, err := m.ctx.prevValuePatterns(stripansi.Strip(text))
+	if err != nil {
+		return "", err
+	}
+	lc := &lineCounter{}
+	for _, p := range pats {
+		prevVals, err := p.prevValues(stripansi.Strip(text), m.maskRegExp(), m.lockedMaskFor)
+		if err != nil {
+			return "", err
+		}
+		if len(prevVals) == 0 {
+			continue
+		}
+		lc.reset(stripansi.Strip(text), line)
+		text, err = ansiReplace(NewReplacer(values(prevVals)), text, m.replacement(item, prevVals, map[string]int{}, lc.at))
+		if err != nil {
+			return "", err
 		}
 	}
-	return []byte(inlinedText), nil
+	return text, nil
+}
+
+func (m *Masker) lockedMaskFor(sv SourcedValue) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.maskFor(sv)
 }
@@ -0,0 +1,143 @@
+package terrahelp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported mask strategies, determining how each sensitive value is masked
+const (
+	// MaskStrategyFixed masks every value with MaskNumChar x MaskChar
+	MaskStrategyFixed = "fixed"
+	// MaskStrategyLength masks every value with one MaskChar per character
+	MaskStrategyLength = "length"
+	// MaskStrategyPartial masks every value with MaskNumChar x MaskChar
+	// followed by its last MaskReveal characters
+	MaskStrategyPartial = "partial"
+	// MaskStrategyFingerprint masks every value with MaskNumChar x MaskChar
+	// followed by a keyed (HMAC-SHA256) fingerprint of it, so the same value
+	// is always masked the same way without it being recoverable
+	MaskStrategyFingerprint = "fingerprint"
+)
+
+// Default mask strategy related values
+const (
+	NumberOfRevealedChar = 4
+	FingerprintLen       = 6
+)
+
+// DefaultMaskTemplate is the template named masks are rendered with, within a
+// template {{name}} is replaced by the name of the variable (or detector rule)
+// the value came from, and {{mask}} by the mask as per the mask strategy
+const DefaultMaskTemplate = "<sensitive:{{name}}>"
+
+const maskTemplateName = "{{name}}"
+
+// maskNameGroup is the name of the capture group holding the name within a named mask
+const maskNameGroup = "maskname"
+
+// MaskStrategies returns the supported mask strategies
+func MaskStrategies() []string {
+	return []string{MaskStrategyFixed, MaskStrategyLength, MaskStrategyPartial, MaskStrategyFingerprint}
+}
+
+// validateMaskStrategy checks the mask strategy is known, and
+// that it has everything it requires
+func (m *MaskOpts) validateMaskStrategy() error {
+	if m.NamedMasks && strings.Count(m.template(), maskTemplateName) != 1 {
+		return fmt.Errorf("Mask template %s must contain %s exactly once", m.template(), maskTemplateName)
+	}
+	switch m.strategy() {
+	case MaskStrategyFixed, MaskStrategyLength, MaskStrategyPartial:
+		return nil
+	case MaskStrategyFingerprint:
+		if m.FingerprintKey == "" {
+			return fmt.Errorf("A fingerprint key is required by the %s mask strategy", MaskStrategyFingerprint)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown mask strategy %s specified", m.MaskStrategy)
+}
+
+func (m *MaskOpts) strategy() string {
+	if m.MaskStrategy == "" {
+		return MaskStrategyFixed
+	}
+	return m.MaskStrategy
+}
+
+// maskFor returns the mask for the sensitive value, which is the mask template
+// rendered for it when named masks are enabled, otherwise its strategy mask
+func (m *MaskOpts) maskFor(sv SourcedValue) (string, error) {
+	mask, err := m.strategyMask(sv.Value)
+	if err != nil || !m.NamedMasks {
+		return mask, err
+	}
+	return strings.NewReplacer(maskTemplateName, sv.Name(), prevPatternMaskPlaceholder, mask).Replace(m.template()), nil
+}
+
+// strategyMask returns the mask for the value, as per the mask strategy
+func (m *MaskOpts) strategyMask(v string) (string, error) {
+	switch m.strategy() {
+	case MaskStrategyFixed:
+		return m.getMask(), nil
+	case MaskStrategyLength:
+		return strings.Repeat(m.MaskChar, utf8.RuneCountInString(v)), nil
+	case MaskStrategyPartial:
+		// Never reveal more than half of the value
+		r := []rune(v)
+		if m.MaskReveal <= 0 || m.MaskReveal*2 > len(r) {
+			return m.getMask(), nil
+		}
+		return m.getMask() + string(r[len(r)-m.MaskReveal:]), nil
+	case MaskStrategyFingerprint:
+		if m.FingerprintKey == "" {
+			return "", fmt.Errorf("A fingerprint key is required by the %s mask strategy", MaskStrategyFingerprint)
+		}
+		h := hmac.New(sha256.New, []byte(m.FingerprintKey))
+		h.Write([]byte(v))
+		return fmt.Sprintf("%s<%.*s>", m.getMask(), FingerprintLen, hex.EncodeToString(h.Sum(nil))), nil
+	}
+	return "", fmt.Errorf("Unknown mask strategy %s specified", m.MaskStrategy)
+}
+
+// maskRegExp returns the regex matching a masked value, capturing the
+// name within it (in the maskname named group) for named masks
+func (m *MaskOpts) maskRegExp() string {
+	if !m.NamedMasks {
+		return m.strategyMaskRegExp()
+	}
+	return strings.NewReplacer(
+		regexp.QuoteMeta(maskTemplateName), `(?P<`+maskNameGroup+`>[^"\s]+?)`,
+		regexp.QuoteMeta(prevPatternMaskPlaceholder), m.strategyMaskRegExp(),
+	).Replace(regexp.QuoteMeta(m.template()))
+}
+
+func (m *MaskOpts) template() string {
+	if m.MaskTemplate == "" {
+		return DefaultMaskTemplate
+	}
+	return m.MaskTemplate
+}
+
+// strategyMaskRegExp returns the regex matching a value masked as per the mask strategy
+func (m *MaskOpts) strategyMaskRegExp() string {
+	masked := fixedMaskRegExp(m.MaskChar)
+	switch m.strategy() {
+	case MaskStrategyPartial:
+		return fmt.Sprintf(`%s[^"\n]{0,%d}`, masked, m.MaskReveal)
+	case MaskStrategyFingerprint:
+		return fmt.Sprintf(`%s<[0-9a-f]{%d}>`, masked, FingerprintLen)
+	}
+	return masked
+}
+
+// fixedMaskRegExp returns the regex matching a value masked with the mask char
+func fixedMaskRegExp(maskChar string) string {
+	return "(?:" + regexp.QuoteMeta(maskChar) + ")+"
+}
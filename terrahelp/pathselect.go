@@ -0,0 +1,220 @@
+package terrahelp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathSelector selects values within a JSON, YAML or HCL document by their path, e.g.
+//
+//	outputs.*.value
+//	resources[type=aws_db_instance].instances[*].attributes.password
+//	data.*
+//
+// Paths are made up of keys separated by dots (quoted should they contain dots or
+// brackets), where * matches any key (or array element), followed by any number of
+// [*] (any element), [n] (the element at index n) or [key=value] (the elements,
+// which are objects, whose key has the value). Selecting an object or array
+// selects every string within it. The blocks of an HCL document are selected by
+// their type followed by each of their labels e.g. resource.aws_db_instance.db.
+type PathSelector struct {
+	path  string
+	steps []selectorStep
+}
+
+type selectorStepKind int
+
+const (
+	stepKey selectorStepKind = iota
+	stepAny
+	stepIndex
+	stepFilter
+)
+
+type selectorStep struct {
+	kind  selectorStepKind
+	key   string
+	index int
+	value string
+}
+
+// ParsePathSelector parses the path selector, a leading $. being optional
+func ParsePathSelector(path string) (*PathSelector, error) {
+	s := &PathSelector{path: path}
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("Invalid path selector %s : the path is empty", path)
+	}
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			if i == 0 || i == len(p)-1 || p[i+1] == '.' || p[i+1] == '[' {
+				return nil, fmt.Errorf("Invalid path selector %s : empty key at offset %d", path, i)
+			}
+			i++
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path selector %s : unclosed [ at offset %d", path, i)
+			}
+			step, err := parseSelectorBracket(p[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path selector %s : %s", path, err)
+			}
+			s.steps = append(s.steps, step)
+			i += end + 1
+		case '"':
+			end := strings.IndexByte(p[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path selector %s : unclosed quote at offset %d", path, i)
+			}
+			s.steps = append(s.steps, selectorStep{kind: stepKey, key: p[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			end := strings.IndexAny(p[i:], ".[")
+			if end < 0 {
+				end = len(p) - i
+			}
+			key := p[i : i+end]
+			if key == "*" {
+				s.steps = append(s.steps, selectorStep{kind: stepAny})
+			} else {
+				s.steps = append(s.steps, selectorStep{kind: stepKey, key: key})
+			}
+			i += end
+		}
+	}
+	return s, nil
+}
+
+func parseSelectorBracket(b string) (selectorStep, error) {
+	if b == "*" {
+		return selectorStep{kind: stepAny}, nil
+	}
+	if i := strings.IndexByte(b, '='); i >= 0 {
+		key, value := strings.TrimSpace(b[:i]), strings.TrimSpace(b[i+1:])
+		if key == "" {
+			return selectorStep{}, fmt.Errorf("no key to filter on in [%s]", b)
+		}
+		return selectorStep{kind: stepFilter, key: key, value: strings.Trim(value, `"'`)}, nil
+	}
+	n, err := strconv.Atoi(b)
+	if err != nil || n < 0 {
+		return selectorStep{}, fmt.Errorf("[%s] is neither *, an index nor a key=value filter", b)
+	}
+	return selectorStep{kind: stepIndex, index: n}, nil
+}
+
+// String returns the path of the selector
+func (s *PathSelector) String() string {
+	return s.path
+}
+
+// selectStrings returns the strings selected within the document (beneath the root)
+func (s *PathSelector) selectStrings(root *docNode) []*docNode {
+	nodes := []*docNode{root}
+	for _, step := range s.steps {
+		var next []*docNode
+		for _, n := range nodes {
+			next = append(next, step.apply(n)...)
+		}
+		nodes = next
+	}
+	var strs []*docNode
+	for _, n := range nodes {
+		strs = append(strs, n.strings()...)
+	}
+	return strs
+}
+
+func (st selectorStep) apply(n *docNode) []*docNode {
+	switch st.kind {
+	case stepKey:
+		if n.kind == docObject {
+			if c := n.child(st.key); c != nil {
+				return []*docNode{c}
+			}
+		}
+	case stepAny:
+		return n.children
+	case stepIndex:
+		if n.kind == docArray && st.index < len(n.children) {
+			return []*docNode{n.children[st.index]}
+		}
+	case stepFilter:
+		var matched []*docNode
+		for _, c := range n.children {
+			if c.kind != docObject {
+				continue
+			}
+			if v := c.child(st.key); v != nil && (v.kind == docString || v.kind == docScalar) && v.value == st.value {
+				matched = append(matched, c)
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+// selectedStrings returns the strings within the document selected by any of the
+// selectors, for which the include function (if any) returns true
+func selectedStrings(d *document, selectors []*PathSelector, include func(v string) bool, counts map[string]int) []*docNode {
+	seen := map[*docNode]bool{}
+	var strs []*docNode
+	for _, root := range d.roots {
+		for _, s := range selectors {
+			for _, n := range s.selectStrings(root) {
+				if !seen[n] && (include == nil || include(n.value)) {
+					seen[n] = true
+					strs = append(strs, n)
+					counts[s.String()]++
+				}
+			}
+		}
+	}
+	return strs
+}
+
+// encryptSelected encrypts (in full) each of the strings within the (JSON, YAML or HCL)
+// document selected by the selectors, leaving the rest of the document as is. Strings
+// which are empty or already encrypted are left as they are, so newly added values can
+// be encrypted by encrypting the document again.
+func (t *CryptoHandler) encryptSelected(ctx *CryptoHandlerOpts, name string, plain []byte) ([]byte, error) {
+	d, err := parseDocument(name, string(plain), ctx.DocFormat)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	key := ctx.EncryptionKey()
+	unencrypted := func(v string) bool { return v != "" && !encryptedValueRegExp.MatchString(v) }
+	out, err := d.replace(selectedStrings(d, ctx.Selectors, unencrypted, counts), func(v string) (string, error) {
+		ct, err := t.Encrypter.Encrypt(key, []byte(v))
+		return string(ct), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.logReplacements("encrypted", counts)
+	return []byte(out), nil
+}
+
+// decryptSelected decrypts the encrypted values within each of the strings of
+// the (JSON, YAML or HCL) document selected by the selectors
+func (t *CryptoHandler) decryptSelected(ctx *CryptoHandlerOpts, name string, b []byte) ([]byte, error) {
+	d, err := parseDocument(name, string(b), ctx.DocFormat)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	key := ctx.EncryptionKey()
+	out, err := d.replace(selectedStrings(d, ctx.Selectors, nil, counts), func(v string) (string, error) {
+		dec, err := t.decryptInline([]byte(v), key)
+		return string(dec), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.logReplacements("decrypted", counts)
+	return []byte(out), nil
+}
@@ -0,0 +1,178 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func testPathSelectors(t *testing.T, paths ...string) []*PathSelector {
+	var selectors []*PathSelector
+	for _, p := range paths {
+		s, err := ParsePathSelector(p)
+		assert.NoError(t, err)
+		selectors = append(selectors, s)
+	}
+	return selectors
+}
+
+func encryptedCount(b []byte) int {
+	return len(regexp.MustCompile(thCryptoWrapRegExp).FindAll(b, -1))
+}
+
+func TestParsePathSelector(t *testing.T) {
+	s, err := ParsePathSelector(`$.resources[type=aws_db_instance].instances[*].attributes."a.b"[0]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []selectorStep{
+		{kind: stepKey, key: "resources"},
+		{kind: stepFilter, key: "type", value: "aws_db_instance"},
+		{kind: stepKey, key: "instances"},
+		{kind: stepAny},
+		{kind: stepKey, key: "attributes"},
+		{kind: stepKey, key: "a.b"},
+		{kind: stepIndex, index: 0},
+	}, s.steps)
+
+	for _, p := range []string{"", "a..b", "a.", "a[", "a[x]", "a[=b]", `a."b`} {
+		_, err := ParsePathSelector(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestCryptoHandler_encryptSelected_JSON(t *testing.T) {
+	// Given
+	b, err := ioutil.ReadFile("test-data/example-project/original/terraform.tfstate")
+	assert.NoError(t, err)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Selectors = testPathSelectors(t, "outputs.*.value", "resources[type=template_dir].instances[*].attributes.vars.msg1")
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptSelected(ctx, "terraform.tfstate", b)
+
+	// Then only the selected values are encrypted, the rest left as is
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(enc))
+	assert.Equal(t, 3, encryptedCount(enc))
+	assert.Contains(t, string(enc), `"msg2": "normal value 1",`)
+	assert.Contains(t, string(enc), `"msg3": "sensitive-value-3-//dfhs//",`)
+	assert.Contains(t, string(enc), `"type": "template_dir",`)
+
+	// And decrypting restores the document exactly
+	dec, err := h.decryptSelected(ctx, "terraform.tfstate", enc)
+	assert.NoError(t, err)
+	assert.Equal(t, string(b), string(dec))
+}
+
+func TestCryptoHandler_encryptSelected_AlreadyEncryptedValues(t *testing.T) {
+	// Given a document with some of the selected values already encrypted
+	b, err := ioutil.ReadFile("test-data/example-project/original/terraform.tfstate")
+	assert.NoError(t, err)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Selectors = testPathSelectors(t, "outputs.*.value")
+	ctx.AllowDoubleEncrypt = false
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	enc, err := h.encryptSelected(ctx, "terraform.tfstate", b)
+	assert.NoError(t, err)
+	ctx = defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Selectors = testPathSelectors(t, "outputs.*.value", "resources[type=template_dir].instances[*].attributes.vars.msg1")
+	ctx.AllowDoubleEncrypt = false
+
+	// When
+	reenc, err := h.encryptSelected(ctx, "terraform.tfstate", enc)
+
+	// Then only the newly selected value is encrypted, the rest left as they are
+	assert.NoError(t, err)
+	assert.Equal(t, 3, encryptedCount(reenc))
+	dec, err := h.decryptSelected(ctx, "terraform.tfstate", reenc)
+	assert.NoError(t, err)
+	assert.Equal(t, string(b), string(dec))
+}
+
+func TestCryptoHandler_encryptSelected_YAML(t *testing.T) {
+	// Given kubernetes secrets
+	b, err := ioutil.ReadFile("test-data/select/secrets.yaml")
+	assert.NoError(t, err)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Selectors = testPathSelectors(t, "data.*", "stringData")
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptSelected(ctx, "secrets.yaml", b)
+
+	// Then the data of both secrets is encrypted, comments and all else left as is
+	assert.NoError(t, err)
+	assert.Equal(t, 5, encryptedCount(enc))
+	for _, l := range []string{"# Kubernetes secrets\n", "  labels: {app: db, tier: \"backend\"}\n", "  name: api-key\n", "   # admin\n", "\n  token: '@terrahelp"} {
+		assert.Contains(t, string(enc), l)
+	}
+	assert.NotContains(t, string(enc), "s3cr3t")
+
+	// And decrypting restores the same values
+	dec, err := h.decryptSelected(ctx, "secrets.yaml", enc)
+	assert.NoError(t, err)
+	assert.Equal(t, yamlDocuments(t, string(b)), yamlDocuments(t, string(dec)))
+	assert.Contains(t, string(dec), "  username: YWRtaW4=   # admin\n")
+	assert.Contains(t, string(dec), "  key: a2V5LUtKU0RI\n")
+}
+
+func yamlDocuments(t *testing.T, s string) []interface{} {
+	var docs []interface{}
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	for {
+		var d interface{}
+		if err := dec.Decode(&d); err != nil {
+			return docs
+		}
+		docs = append(docs, d)
+	}
+}
+
+func TestCryptoHandler_encryptSelected_HCL(t *testing.T) {
+	// Given
+	b, err := ioutil.ReadFile("test-data/select/config.hcl")
+	assert.NoError(t, err)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Selectors = testPathSelectors(t, "db_password", "db_port", "inputs.names[1]", "inputs.ref",
+		"inputs[api_key=api-key-HDKSJ]", "resource.aws_db_instance.db.password")
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptSelected(ctx, "config.hcl", b)
+
+	// Then the selected string literals are encrypted (not the number, nor
+	// the template), the result remaining valid HCL
+	assert.NoError(t, err)
+	assert.Equal(t, 3, encryptedCount(enc))
+	_, diags := hclsyntax.ParseConfig(enc, "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	assert.False(t, diags.HasErrors())
+	assert.Contains(t, string(enc), `names   = ["first-JSKD", "@terrahelp-encrypted(`)
+	assert.Contains(t, string(enc), `api_key = "api-key-HDKSJ"`)
+	assert.Contains(t, string(enc), "db_port     = 5432\n")
+	assert.Contains(t, string(enc), `ref     = "${local.value}"`)
+	assert.NotContains(t, string(enc), "heredoc-secret-DKSJ")
+
+	// And decrypting restores the values, the heredoc as a quoted string
+	dec, err := h.decryptSelected(ctx, "config.hcl", enc)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Replace(string(b), "<<EOT\nheredoc-secret-DKSJ\nEOT", `"heredoc-secret-DKSJ\n"`, 1), string(dec))
+}
+
+func TestParseDocument_UnknownFormat(t *testing.T) {
+	_, err := parseDocument("x", "a = 1", "toml")
+	assert.EqualError(t, err, "Unknown document format toml specified")
+}
+
+func TestDocFormat(t *testing.T) {
+	assert.Equal(t, DocFormatJSON, docFormat("stdin", `{"a": 1}`))
+	assert.Equal(t, DocFormatHCL, docFormat("stdin", `a = "b"`))
+	assert.Equal(t, DocFormatYAML, docFormat("stdin", "a: b\n"))
+	assert.Equal(t, DocFormatYAML, docFormat("values.yml", `{"a": 1}`))
+}
@@ -0,0 +1,205 @@
+package terrahelp
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Terraform plan files (e.g. as written by terraform plan -out=tfplan) are zip archives
+// holding the plan itself (in protobuf, including the values of the variables), the
+// prior state (as JSON) and a snapshot of the configuration
+const (
+	planMember = "tfplan"
+	// binaryChunkSize is the size of each chunk binary content (e.g. a plan file)
+	// is encrypted in, when encrypted in the binary format
+	binaryChunkSize = 1024 * 1024
+)
+
+// PlanFormat returns true if the content is a plan file to be encrypted member by member
+func (o *CryptoHandlerOpts) PlanFormat() bool {
+	return o.Format == ThEncryptFormatPlan
+}
+
+// BinaryFormat returns true if the content is to be encrypted in full a chunk at a time
+func (o *CryptoHandlerOpts) BinaryFormat() bool {
+	return o.Format == ThEncryptFormatBinary
+}
+
+// encryptBinary encrypts the (binary) content in full as it is read, a chunk at a
+// time, each chunk written out encrypted on a line of its own, so content of any
+// size (e.g. a plan file) can be encrypted using bounded memory
+func (t *CryptoHandler) encryptBinary(ctx *CryptoHandlerOpts, in io.Reader, out io.Writer) error {
+	chunk := make([]byte, binaryChunkSize)
+	for {
+		n, err := io.ReadFull(in, chunk)
+		if n > 0 {
+			if encErr := checkNotEncrypted(ctx, chunk[:n]); encErr != nil {
+				return encErr
+			}
+			enc, encErr := t.Encrypter.Encrypt(ctx.EncryptionKey(), chunk[:n])
+			if encErr != nil {
+				return encErr
+			}
+			if _, encErr = out.Write(append(enc, '\n')); encErr != nil {
+				return encErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decryptBinary decrypts the content encrypted in the binary format, a line
+// (i.e. chunk) at a time
+func (t *CryptoHandler) decryptBinary(ctx *CryptoHandlerOpts, in io.Reader, out io.Writer) error {
+	key := ctx.EncryptionKey()
+	br := bufio.NewReader(in)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			dec, decErr := t.Encrypter.Decrypt(key, line)
+			if decErr != nil {
+				return decErr
+			}
+			if _, decErr = out.Write(dec); decErr != nil {
+				return decErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// encryptPlan encrypts each of the members of the plan file in full, the result
+// remaining a zip archive, listing the same members
+func (t *CryptoHandler) encryptPlan(ctx *CryptoHandlerOpts, plain []byte) ([]byte, error) {
+	key := ctx.EncryptionKey()
+	return rewriteZip(plain, func(name string, b []byte) ([]byte, error) {
+		return t.encryptFullContent(b, key, ctx.AllowDoubleEncrypt)
+	})
+}
+
+// decryptPlan decrypts each of the members of the plan file encrypted member by member
+func (t *CryptoHandler) decryptPlan(ctx *CryptoHandlerOpts, b []byte) ([]byte, error) {
+	key := ctx.EncryptionKey()
+	return rewriteZip(b, func(name string, b []byte) ([]byte, error) {
+		if !bytes.HasPrefix(b, []byte(thCryptoWrapPrefix)) {
+			return b, nil
+		}
+		return t.Encrypter.Decrypt(key, b)
+	})
+}
+
+// maskPlan masks the sensitive values within each of the members of the plan file,
+// giving a sanitised copy of it. The prior state, and any other JSON or text member
+// (e.g. the configuration), are masked as they would be in the JSON format, so remain
+// valid. The plan itself is binary, so (as its values are held as is) each value is
+// masked with the mask char repeated to the same length (in bytes), leaving the
+// lengths encoded within it valid.
+func (m *Masker) maskPlan(plain []byte) ([]byte, error) {
+	sensitiveVals, err := m.sensitiveValues("")
+	if err != nil {
+		return nil, err
+	}
+	r := NewReplacer(values(sensitiveVals))
+	counts := map[string]int{}
+	out, err := rewriteZip(plain, func(name string, b []byte) ([]byte, error) {
+		item := m.item + ":" + name
+		if name != planMember {
+			masked, err := m.maskJSONDocument(item, string(b), 1, r, sensitiveVals, counts)
+			return []byte(masked), err
+		}
+		return m.maskBinary(item, b, counts)
+	})
+	m.ctx.logReplacements("masked", counts)
+	return out, err
+}
+
+// maskBinary masks the sensitive values, including any detected, within the binary
+// content with the mask char repeated to the same length as each value
+func (m *Masker) maskBinary(item string, b []byte, counts map[string]int) ([]byte, error) {
+	svs, err := m.sensitiveValues(string(b))
+	if err != nil {
+		return nil, err
+	}
+	lc := &lineCounter{}
+	lc.reset(string(b), 1)
+	record := m.replacement(item, svs, counts, lc.at)
+	mask := m.ctx.MaskChar
+	if len(mask) != 1 {
+		mask = MaskChar
+	}
+	masked, _, err := NewReplacer(values(svs)).replacePrefix(string(b), true, func(rm replacerMatch) (string, error) {
+		if _, err := record(rm); err != nil {
+			return "", err
+		}
+		return strings.Repeat(mask, rm.end-rm.start), nil
+	})
+	return []byte(masked), err
+}
+
+// rewriteZip returns a copy of the zip archive with the content of each of its
+// (file) members replaced by the result of calling f with it
+func rewriteZip(b []byte, f func(name string, b []byte) ([]byte, error)) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the plan file : %s", err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, zf := range zr.File {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:           zf.Name,
+			Comment:        zf.Comment,
+			Method:         zf.Method,
+			Modified:       zf.Modified,
+			ExternalAttrs:  zf.ExternalAttrs,
+			CreatorVersion: zf.CreatorVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		content, err := readZipMember(zf)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = f(zf.Name, content); err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.SetComment(zr.Comment); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readZipMember(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
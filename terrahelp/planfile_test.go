@@ -0,0 +1,199 @@
+package terrahelp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const planTestSecret = "db-password-HSKDJ"
+
+// planTestMembers mimics the members of a terraform plan file, the plan itself holding
+// the (msgpack encoded) variable value, prefixed by its length, within its protobuf
+var planTestMembers = map[string]string{
+	"tfplan":             "\x0a\x02db\x12\x13\xd9\x11" + planTestSecret + "\x1a\x05apply",
+	"tfstate":            `{"version":4,"outputs":{"password":{"value":"` + planTestSecret + `","sensitive":true}}}`,
+	"tfconfig/":          "",
+	"tfconfig/main.tf":   "resource \"aws_db_instance\" \"db\" {\n  password = \"" + planTestSecret + "\"\n}\n",
+	"tfconfig/dummy.bin": "",
+}
+
+var planTestOrder = []string{"tfplan", "tfstate", "tfconfig/", "tfconfig/main.tf", "tfconfig/dummy.bin"}
+
+// planTestFile writes a plan file, the dummy member (stored uncompressed) of which holds
+// the random padding, so the plan file can be made larger than a single chunk
+func planTestFile(t *testing.T, padding int) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range planTestOrder {
+		method := zip.Deflate
+		content := []byte(planTestMembers[name])
+		if name == "tfconfig/dummy.bin" {
+			method = zip.Store
+			content = make([]byte, padding)
+			rand.New(rand.NewSource(1)).Read(content)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		assert.NoError(t, err)
+		_, err = w.Write(content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func planMembers(t *testing.T, b []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("Unable to read plan file : %s", err)
+	}
+	members := map[string]string{}
+	for _, zf := range zr.File {
+		content, err := readZipMember(zf)
+		assert.NoError(t, err)
+		members[zf.Name] = string(content)
+	}
+	return members
+}
+
+func TestCryptoHandler_Encrypt_BinaryPlanFileStream(t *testing.T) {
+	// Given a plan file larger than 2 chunks
+	plan := planTestFile(t, 2*binaryChunkSize+1024)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Format = ThEncryptFormatBinary
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	var enc bytes.Buffer
+	ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(plan), &enc)}
+
+	// When
+	err := h.Encrypt(ctx)
+
+	// Then it is encrypted a chunk at a time, each on a line of its own
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(enc.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for _, l := range lines {
+		assert.Regexp(t, regexp.MustCompile("^"+thCryptoWrapRegExp+"$"), l)
+	}
+
+	// And it is restored exactly when decrypted, streamed or otherwise
+	var dec bytes.Buffer
+	ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(enc.Bytes()), &dec)}
+	assert.NoError(t, h.Decrypt(ctx))
+	assert.Equal(t, plan, dec.Bytes())
+	b, err := h.decryptBytes(ctx, enc.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, plan, b)
+}
+
+func TestCryptoHandler_Encrypt_BinaryAlreadyEncrypted(t *testing.T) {
+	// Given content already encrypted in the binary format
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Format = ThEncryptFormatBinary
+	ctx.AllowDoubleEncrypt = false
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	var enc bytes.Buffer
+	assert.NoError(t, h.encryptBinary(ctx, bytes.NewReader(planTestFile(t, 16)), &enc))
+
+	// When
+	ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(enc.Bytes()), &bytes.Buffer{})}
+	err := h.Encrypt(ctx)
+
+	// Then
+	assert.EqualError(t, err, "terrahelp encryption error : "+errMsgAlreadyEncrypted)
+}
+
+func TestCryptoHandler_Decrypt_FullWholeContent(t *testing.T) {
+	// Given content, including a plan file, encrypted in full as a whole, as it
+	// always has been, the ciphertext ending in a newline (e.g. added by an editor)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	for _, plain := range []string{"line 1\nline 2\n", string(planTestFile(t, 16))} {
+		enc, err := h.encryptFullContent([]byte(plain), ctx.SimpleKey, true)
+		assert.NoError(t, err)
+
+		// When
+		var dec bytes.Buffer
+		ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(append(enc, '\n')), &dec)}
+		err = h.Decrypt(ctx)
+
+		// Then it is still decrypted as a whole
+		assert.NoError(t, err)
+		assert.Equal(t, plain, dec.String())
+	}
+
+	// And is still encrypted as a whole in full mode
+	var enc bytes.Buffer
+	ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(planTestFile(t, 16)), &enc)}
+	assert.NoError(t, h.Encrypt(ctx))
+	assert.Regexp(t, regexp.MustCompile("^"+thCryptoWrapRegExp+"$"), enc.String())
+}
+
+func TestCryptoHandler_encryptPlan(t *testing.T) {
+	// Given
+	plan := planTestFile(t, 16)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, "")
+	ctx.Format = ThEncryptFormatPlan
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptPlan(ctx, plan)
+
+	// Then it remains a plan file listing the same members, each of which is encrypted
+	assert.NoError(t, err)
+	members := planMembers(t, enc)
+	assert.Len(t, members, len(planTestOrder))
+	assert.Equal(t, "", members["tfconfig/"])
+	for _, name := range []string{"tfplan", "tfstate", "tfconfig/main.tf", "tfconfig/dummy.bin"} {
+		assert.Regexp(t, regexp.MustCompile("^"+thCryptoWrapRegExp+"$"), members[name])
+	}
+
+	// And each member is restored when decrypted
+	dec, err := h.decryptBytes(ctx, enc)
+	assert.NoError(t, err)
+	assert.Equal(t, planMembers(t, plan), planMembers(t, dec))
+}
+
+func TestCryptoHandler_encryptPlan_NotPlanFile(t *testing.T) {
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	_, err := h.encryptPlan(defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ""), []byte("not a zip"))
+	assert.EqualError(t, err, "Unable to read the plan file : zip: not a valid zip file")
+}
+
+func TestMasker_maskPlan(t *testing.T) {
+	// Given
+	plan := planTestFile(t, 16)
+	ctx := NewDefaultMaskOpts()
+	ctx.Format = MaskFormatPlan
+	m := NewMasker(ctx, &DefaultReplaceables{[]string{planTestSecret}})
+	var out bytes.Buffer
+	ctx.TransformItems = []Transformable{NewStreamTransformable(bytes.NewReader(plan), &out)}
+
+	// When
+	err := m.Mask()
+
+	// Then a sanitised copy of the plan file is written, the plan itself masked
+	// to the same length, and the state and configuration masked as usual
+	assert.NoError(t, err)
+	members := planMembers(t, out.Bytes())
+	assert.Len(t, members, len(planTestOrder))
+	assert.Equal(t, strings.Replace(planTestMembers["tfplan"], planTestSecret, strings.Repeat("*", len(planTestSecret)), 1), members["tfplan"])
+	assert.Equal(t, `{"version":4,"outputs":{"password":{"value":"******","sensitive":true}}}`, members["tfstate"])
+	assert.True(t, json.Valid([]byte(members["tfstate"])))
+	assert.Equal(t, "resource \"aws_db_instance\" \"db\" {\n  password = \"******\"\n}\n", members["tfconfig/main.tf"])
+	assert.Equal(t, 3, m.Report().Total)
+}
+
+func TestExecutor_Run_PlanFormat(t *testing.T) {
+	ctx := NewDefaultMaskOpts()
+	ctx.Format = MaskFormatPlan
+	e := NewExecutor(NewMasker(ctx, &DefaultReplaceables{}))
+	_, err := e.Run("true")
+	assert.EqualError(t, err, "The plan format can not be used to mask the output of a command")
+}
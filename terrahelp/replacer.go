@@ -0,0 +1,212 @@
+package terrahelp
+
+import (
+	"strings"
+)
+
+// Replacer finds, in a single pass over some content, all of the non overlapping
+// leftmost longest occurrences of a set of values (using an Aho-Corasick automaton),
+// so each occurrence is replaced exactly once. Unlike replacing one value after
+// another, text produced by a replacement is never itself matched.
+type Replacer struct {
+	values []string
+	nodes  []acNode
+	maxLen int
+}
+
+type acNode struct {
+	next  map[byte]int
+	fail  int
+	depth int
+	// value is the index of the value ending at this node, or -1
+	value int
+	// dict is the nearest node, along the fail links, at which a value ends, or -1
+	dict int
+}
+
+// replacerMatch is an occurrence of a value within some content
+type replacerMatch struct {
+	start, end, value int
+}
+
+// NewReplacer creates a new Replacer for the (non empty) values, the
+// first index is kept should a value be provided more than once
+func NewReplacer(values []string) *Replacer {
+	r := &Replacer{values: values, nodes: []acNode{newACNode(0)}}
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		if len(v) > r.maxLen {
+			r.maxLen = len(v)
+		}
+		n := 0
+		for j := 0; j < len(v); j++ {
+			c, ok := r.nodes[n].next[v[j]]
+			if !ok {
+				c = len(r.nodes)
+				r.nodes = append(r.nodes, newACNode(j+1))
+				r.nodes[n].next[v[j]] = c
+			}
+			n = c
+		}
+		if r.nodes[n].value < 0 {
+			r.nodes[n].value = i
+		}
+	}
+
+	// Breadth first, link each node to the node for its longest proper
+	// suffix, and to the nearest such suffix node at which a value ends
+	queue := []int{}
+	for _, c := range r.nodes[0].next {
+		queue = append(queue, c)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for b, c := range r.nodes[n].next {
+			f := r.nodes[n].fail
+			for {
+				if fc, ok := r.nodes[f].next[b]; ok && fc != c {
+					r.nodes[c].fail = fc
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = r.nodes[f].fail
+			}
+			fail := r.nodes[c].fail
+			if r.nodes[fail].value >= 0 {
+				r.nodes[c].dict = fail
+			} else {
+				r.nodes[c].dict = r.nodes[fail].dict
+			}
+			queue = append(queue, c)
+		}
+	}
+	return r
+}
+
+func newACNode(depth int) acNode {
+	return acNode{next: map[byte]int{}, depth: depth, value: -1, dict: -1}
+}
+
+// MaxLen returns the length of the longest value
+func (r *Replacer) MaxLen() int {
+	return r.maxLen
+}
+
+func (r *Replacer) step(n int, b byte) int {
+	for {
+		if c, ok := r.nodes[n].next[b]; ok {
+			return c
+		}
+		if n == 0 {
+			return 0
+		}
+		n = r.nodes[n].fail
+	}
+}
+
+// findAll returns the non overlapping leftmost longest occurrences
+// of the values within the content, in order
+func (r *Replacer) findAll(s string) []replacerMatch {
+	var matches []replacerMatch
+	if r.maxLen == 0 {
+		return matches
+	}
+	for i := 0; i < len(s); {
+		best := replacerMatch{start: -1}
+		n := 0
+		j := i
+		for ; j < len(s); j++ {
+			n = r.step(n, s[j])
+			// The longest value ending here is also the one starting leftmost
+			m := n
+			if r.nodes[m].value < 0 {
+				m = r.nodes[m].dict
+			}
+			if m >= 0 {
+				start := j + 1 - r.nodes[m].depth
+				if best.start < 0 || start < best.start || (start == best.start && j+1 > best.end) {
+					best = replacerMatch{start: start, end: j + 1, value: r.nodes[m].value}
+				}
+			}
+			// Stop once no (longer) match can start at or before the best one
+			if best.start >= 0 && j+1-r.nodes[n].depth > best.start {
+				break
+			}
+		}
+		if best.start < 0 {
+			break
+		}
+		matches = append(matches, best)
+		i = best.end
+	}
+	return matches
+}
+
+// Replace returns a copy of the content with each occurrence of a value replaced
+// by the result of calling f with the index of the value, stopping on any error
+func (r *Replacer) Replace(s string, f func(value int) (string, error)) (string, error) {
+	out, _, err := r.ReplacePrefix(s, true, f)
+	return out, err
+}
+
+// ReplacePrefix replaces the occurrences of the values within the part of the
+// content which can not be affected by any content which follows it, returning
+// that part (replaced) and the rest. Should the content be final, all of it
+// is replaced. Replacing each part of some content in turn gives exactly the
+// same result as replacing all the content at once.
+func (r *Replacer) ReplacePrefix(s string, final bool, f func(value int) (string, error)) (string, string, error) {
+	return r.replacePrefix(s, final, func(m replacerMatch) (string, error) { return f(m.value) })
+}
+
+// replacePrefix is ReplacePrefix, with f provided with each occurrence
+// (so where it is within the content) rather than just its value
+func (r *Replacer) replacePrefix(s string, final bool, f func(m replacerMatch) (string, error)) (string, string, error) {
+	matches, consumed := r.prefixMatches(s, final)
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		rep, err := f(m)
+		if err != nil {
+			return "", "", err
+		}
+		sb.WriteString(s[last:m.start])
+		sb.WriteString(rep)
+		last = m.end
+	}
+	sb.WriteString(s[last:consumed])
+	return sb.String(), s[consumed:], nil
+}
+
+// prefixMatches returns the occurrences of the values within the part of the
+// content which can not be affected by any content which follows it, along
+// with the length of that part. Should the content be final, it is all of it.
+func (r *Replacer) prefixMatches(s string, final bool) ([]replacerMatch, int) {
+	matches := r.findAll(s)
+	if final {
+		return matches, len(s)
+	}
+
+	// A match could only extend beyond the content when starting
+	// within its longest suffix which is the prefix of a value
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = r.step(n, s[i])
+	}
+	safe := len(s) - r.nodes[n].depth
+
+	consumed := safe
+	for i, m := range matches {
+		if m.start >= safe {
+			return matches[:i], consumed
+		}
+		if m.end > consumed {
+			consumed = m.end
+		}
+	}
+	return matches, consumed
+}
@@ -0,0 +1,112 @@
+package terrahelp
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func replaceWithNames(r *Replacer, s string) string {
+	out, _ := r.Replace(s, func(i int) (string, error) {
+		return fmt.Sprintf("<%d>", i), nil
+	})
+	return out
+}
+
+func TestReplacer_Replace(t *testing.T) {
+	scenarios := []struct {
+		values   []string
+		in       string
+		expected string
+	}{
+		{[]string{"secret"}, "no sensitive data", "no sensitive data"},
+		{[]string{"secret"}, "a secret and another secret", "a <0> and another <0>"},
+		// Leftmost wins over longest
+		{[]string{"abcdef", "xabc"}, "xabcdef", "<1>def"},
+		// Longest wins when starting at the same position
+		{[]string{"abc", "abcdef"}, "abcdefg", "<1>g"},
+		// Shorter value within a longer one
+		{[]string{"pass", "my-password"}, "my-password pass", "<1> <0>"},
+		// A value spanning the end of an earlier partial match
+		{[]string{"aab", "ab"}, "aaab", "a<0>"},
+		{[]string{"he", "she", "his", "hers"}, "ushers", "u<1>rs"},
+		// Duplicate and empty values
+		{[]string{"", "dup", "dup"}, "dup", "<1>"},
+		{[]string{}, "anything", "anything"},
+	}
+	for _, s := range scenarios {
+		assert.Equal(t, s.expected, replaceWithNames(NewReplacer(s.values), s.in), "%v in %s", s.values, s.in)
+	}
+}
+
+func TestReplacer_Replace_ReplacementIsNotRematched(t *testing.T) {
+	// Given a value which appears within the replacement of another
+	r := NewReplacer([]string{"long-secret-KSJDH", "MASK"})
+
+	// When
+	out, err := r.Replace("long-secret-KSJDH", func(i int) (string, error) {
+		return "MASKED", nil
+	})
+
+	// Then the replacement is left untouched
+	assert.NoError(t, err)
+	assert.Equal(t, "MASKED", out)
+}
+
+func TestReplacer_Replace_Error(t *testing.T) {
+	r := NewReplacer([]string{"secret"})
+	_, err := r.Replace("a secret", func(i int) (string, error) {
+		return "", fmt.Errorf("failed")
+	})
+	assert.EqualError(t, err, "failed")
+}
+
+// naiveLeftmostLongest is a simple, but slow, reference implementation
+func naiveLeftmostLongest(values []string, s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		best := -1
+		for vi, v := range values {
+			if v != "" && strings.HasPrefix(s[i:], v) && (best < 0 || len(v) > len(values[best])) {
+				best = vi
+			}
+		}
+		if best < 0 {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("<%d>", best))
+		i += len(values[best])
+	}
+	return sb.String()
+}
+
+func TestReplacer_Replace_MatchesReference(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	randString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 500; i++ {
+		// Given a random set of (unique) values over a small alphabet, so they overlap a lot
+		seen := map[string]bool{}
+		var values []string
+		for j := 0; j < 1+rnd.Intn(6); j++ {
+			if v := randString(1 + rnd.Intn(5)); !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+		in := randString(rnd.Intn(40))
+
+		// Then
+		assert.Equal(t, naiveLeftmostLongest(values, in), replaceWithNames(NewReplacer(values), in), "%v in %s", values, in)
+	}
+}
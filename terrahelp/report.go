@@ -0,0 +1,120 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// ErrSensitiveDataMasked is returned by Masker.Mask, when configured to
+// fail on detection, should any sensitive data have been masked
+var ErrSensitiveDataMasked = errors.New("Sensitive data was found, and masked")
+
+// MaskReport summarises what was masked, without revealing any of the values
+type MaskReport struct {
+	Total   int                `json:"total"`
+	Entries []*MaskReportEntry `json:"entries"`
+}
+
+// MaskReportEntry records the occurrences of the values from a
+// single source or variable masked within an item
+type MaskReportEntry struct {
+	Item   string `json:"item"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Count  int    `json:"count"`
+	Lines  []int  `json:"lines"`
+}
+
+// record adds a masked occurrence of the value, on the line of the item
+func (r *MaskReport) record(item string, sv SourcedValue, line int) {
+	r.Total++
+	for _, e := range r.Entries {
+		if e.Item == item && e.Name == sv.Name() && e.Source == sv.Source {
+			e.Count++
+			if e.Lines[len(e.Lines)-1] != line {
+				e.Lines = append(e.Lines, line)
+			}
+			return
+		}
+	}
+	r.Entries = append(r.Entries, &MaskReportEntry{Item: item, Name: sv.Name(), Source: sv.Source, Count: 1, Lines: []int{line}})
+}
+
+// sorted returns the entries ordered by item, then name
+func (r *MaskReport) sorted() []*MaskReportEntry {
+	entries := append([]*MaskReportEntry{}, r.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Item != entries[j].Item {
+			return entries[i].Item < entries[j].Item
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// Write writes out a human readable summary of the report
+func (r *MaskReport) Write(w io.Writer) error {
+	if r.Total == 0 {
+		_, err := fmt.Fprintf(w, "No sensitive data was masked\n")
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Masked %d occurrences of sensitive data\n", r.Total); err != nil {
+		return err
+	}
+	for _, e := range r.sorted() {
+		lines := make([]string, len(e.Lines))
+		for i, l := range e.Lines {
+			lines[i] = fmt.Sprint(l)
+		}
+		if _, err := fmt.Fprintf(w, "  %s: %s (%s) %d occurrences on lines %s\n",
+			e.Item, e.Name, e.Source, e.Count, strings.Join(lines, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes out the report, as JSON, to the file
+func (r *MaskReport) WriteJSON(filename string) error {
+	b, err := json.MarshalIndent(&MaskReport{Total: r.Total, Entries: r.sorted()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(b, '\n'), 0644)
+}
+
+// itemName returns the name the item is reported under
+func itemName(t Transformable) string {
+	if f, ok := t.(*FileTransformable); ok {
+		return f.filename
+	}
+	return "stdin"
+}
+
+// lineCounter provides the line on which each (in order) offset within some content
+// falls, the content typically being the next segment of a larger whole
+type lineCounter struct {
+	s    string
+	pos  int
+	line int
+}
+
+// reset starts counting within the content, beginning on the line
+func (c *lineCounter) reset(s string, line int) {
+	c.s, c.pos, c.line = s, 0, line
+}
+
+// at returns the line on which the offset, which must not precede
+// that of the previous call, falls
+func (c *lineCounter) at(offset int) int {
+	if offset > c.pos {
+		c.line += strings.Count(c.s[c.pos:offset], "\n")
+		c.pos = offset
+	}
+	return c.line
+}
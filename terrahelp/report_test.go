@@ -0,0 +1,127 @@
+package terrahelp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const reportTestContent = `~ key    = "old-secret-DJSKH" -> "sensitive-value-1-AK#%DJGHS*G"
+  other  = "not sensitive"
++ secret = "madeup-aws-secret-key-KGSDGH"
++ ` + "\x1b[1magain\x1b[0m" + `  = "madeup-aws-secret-key-KGSDGH" "madeup-aws-secret-key-KGSDGH"
+`
+
+func TestMasker_maskBytes_Report(t *testing.T) {
+	// Given
+	m := defaultTestMasker(exampleTestTfvars, nil)
+
+	// When
+	_, err := m.maskBytes([]byte(reportTestContent))
+
+	// Then each masked occurrence is reported, on its line
+	assert.NoError(t, err)
+	assert.Equal(t, 5, m.Report().Total)
+	assert.ElementsMatch(t, []*MaskReportEntry{
+		{Item: "stdin", Name: "var.tf_sensitive_key_1", Source: "tfvars:test-data/example-project/original/terraform.tfvars", Count: 1, Lines: []int{1}},
+		{Item: "stdin", Name: "var.pretend_aws_secret_key", Source: "tfvars:test-data/example-project/original/terraform.tfvars", Count: 3, Lines: []int{3, 4}},
+		{Item: "stdin", Name: "attribute-change", Source: "previous-value", Count: 1, Lines: []int{1}},
+	}, m.Report().Entries)
+}
+
+func TestMasker_maskStream_Report(t *testing.T) {
+	// Given
+	expected := defaultTestMasker(exampleTestTfvars, nil)
+	expected.ctx.ReplacePrevVals = false
+	_, err := expected.maskBytes([]byte(reportTestContent))
+	assert.NoError(t, err)
+	m := defaultTestMasker(exampleTestTfvars, nil)
+	m.ctx.ReplacePrevVals = false
+
+	// When the content is streamed one byte at a time
+	var out bytes.Buffer
+	err = m.maskStream(iotest.OneByteReader(strings.NewReader(reportTestContent)), &out)
+
+	// Then the report is the same as when masked all at once
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Report(), m.Report())
+}
+
+func TestMaskReport_Write(t *testing.T) {
+	// Given
+	r := &MaskReport{}
+	r.record("plan.txt", SourcedValue{Value: "b", Source: "env", Variable: "var.b"}, 7)
+	r.record("plan.txt", SourcedValue{Value: "a", Source: "tfvars:terraform.tfvars", Variable: "var.a"}, 2)
+	r.record("plan.txt", SourcedValue{Value: "a", Source: "tfvars:terraform.tfvars", Variable: "var.a"}, 2)
+	r.record("plan.txt", SourcedValue{Value: "a", Source: "tfvars:terraform.tfvars", Variable: "var.a"}, 9)
+	var out bytes.Buffer
+
+	// When
+	err := r.Write(&out)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, `Masked 4 occurrences of sensitive data
+  plan.txt: var.a (tfvars:terraform.tfvars) 3 occurrences on lines 2,9
+  plan.txt: var.b (env) 1 occurrences on lines 7
+`, out.String())
+}
+
+func TestMasker_Mask_ReportFileAndFailOnDetect(t *testing.T) {
+	// Given a file holding sensitive data
+	dir, err := ioutil.TempDir("", "terrahelp-report")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "plan.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(reportTestContent), 0600))
+	m := defaultTestMasker(exampleTestTfvars, nil)
+	m.ctx.TransformItems = []Transformable{NewFileTransformable(file, false, "")}
+	m.ctx.Report = true
+	m.ctx.ReportFilename = filepath.Join(dir, "report.json")
+	m.ctx.FailOnDetect = true
+	var stderr bytes.Buffer
+	m.stderr = &stderr
+
+	// When
+	err = m.Mask()
+
+	// Then the file is masked, yet the masking fails
+	assert.Equal(t, ErrSensitiveDataMasked, err)
+	b, _ := ioutil.ReadFile(file)
+	assert.NotContains(t, string(b), "secret-")
+
+	// and the report written, without any of the values
+	assert.Contains(t, stderr.String(), "Masked 5 occurrences of sensitive data\n")
+	b, err = ioutil.ReadFile(m.ctx.ReportFilename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "secret-")
+	report := &MaskReport{}
+	assert.NoError(t, json.Unmarshal(b, report))
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, file, report.Entries[0].Item)
+}
+
+func TestMasker_Mask_FailOnDetectClean(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "terrahelp-report")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "plan.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("nothing sensitive\n"), 0600))
+	m := defaultTestMasker(exampleTestTfvars, nil)
+	m.ctx.TransformItems = []Transformable{NewFileTransformable(file, false, "")}
+	m.ctx.FailOnDetect = true
+
+	// When
+	err = m.Mask()
+
+	// Then
+	assert.NoError(t, err)
+}
@@ -0,0 +1,96 @@
+package terrahelp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v3"
+)
+
+// rulesFile holds the user defined masking rules as read from a rules
+// file, which may be written in either HCL (or JSON) i.e.
+//
+//	rule "internal-api-key" {
+//	  regex = "ikey_[A-Za-z0-9]{32}"
+//	}
+//
+// or YAML i.e.
+//
+//	rules:
+//	  - id: azure-sas-signature
+//	    regex: "sig=([A-Za-z0-9%]+)"
+//	    capture: 1
+//	    replacement: REDACTED
+type rulesFile struct {
+	Rules []rulesFileRule `hcl:"rule" yaml:"rules"`
+}
+
+type rulesFileRule struct {
+	ID          string  `hcl:",key" yaml:"id"`
+	Description string  `hcl:"description" yaml:"description"`
+	Regex       string  `hcl:"regex" yaml:"regex"`
+	Capture     int     `hcl:"capture" yaml:"capture"`
+	Replacement string  `hcl:"replacement" yaml:"replacement"`
+	MinEntropy  float64 `hcl:"min_entropy" yaml:"min_entropy"`
+	Disabled    bool    `hcl:"disabled" yaml:"disabled"`
+}
+
+// LoadDetectorRulesFile reads the user defined masking rules held in the
+// HCL, JSON or YAML rules file, returning the rules which are not disabled
+func LoadDetectorRulesFile(f string) ([]*DetectorRule, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rf := &rulesFile{}
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, rf)
+	default:
+		err = hcl.Unmarshal(b, rf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse rules file %s : %s", f, err)
+	}
+
+	var rules []*DetectorRule
+	ids := map[string]bool{}
+	for _, r := range rf.Rules {
+		if r.ID == "" {
+			return nil, fmt.Errorf("Rules file %s contains a rule without an id", f)
+		}
+		if ids[r.ID] {
+			return nil, fmt.Errorf("Rules file %s contains the rule %s more than once", f, r.ID)
+		}
+		ids[r.ID] = true
+
+		if r.Regex == "" {
+			return nil, fmt.Errorf("Rule %s has no regex", r.ID)
+		}
+		p, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %s has an invalid regex : %s", r.ID, err)
+		}
+		if r.Capture < 0 || r.Capture > p.NumSubexp() {
+			return nil, fmt.Errorf("Rule %s has no capture group %d", r.ID, r.Capture)
+		}
+		if r.Disabled {
+			continue
+		}
+		rules = append(rules, &DetectorRule{
+			ID:             r.ID,
+			Description:    r.Description,
+			Pattern:        p,
+			Group:          r.Capture,
+			MinEntropy:     r.MinEntropy,
+			DefaultEnabled: true,
+			Replacement:    r.Replacement,
+		})
+	}
+	return rules, nil
+}
@@ -0,0 +1,83 @@
+package terrahelp
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDetectorRulesFile(t *testing.T) {
+	for _, f := range []string{"test-data/rules/rules.hcl", "test-data/rules/rules.yaml"} {
+		// When
+		rules, err := LoadDetectorRulesFile(f)
+
+		// Then
+		assert.NoError(t, err, f)
+		if assert.Len(t, rules, 2, f) {
+			assert.Equal(t, "internal-api-key", rules[0].ID)
+			assert.Equal(t, "Internal API keys", rules[0].Description)
+			assert.Equal(t, 0, rules[0].Group)
+			assert.Equal(t, "azure-sas-signature", rules[1].ID)
+			assert.Equal(t, 1, rules[1].Group)
+			assert.Equal(t, "REDACTED", rules[1].Replacement)
+		}
+	}
+}
+
+func TestLoadDetectorRulesFile_Invalid(t *testing.T) {
+	scenarios := map[string]string{
+		`rule "a" { regex = "(" }`:                          "Rule a has an invalid regex",
+		`rule "a" { description = "x" }`:                    "Rule a has no regex",
+		`rule "a" { regex = "x"  capture = 1 }`:             "Rule a has no capture group 1",
+		`rule "a" { regex = "x" } rule "a" { regex = "y" }`: "contains the rule a more than once",
+	}
+	dir, err := ioutil.TempDir("", "rulesfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for content, expected := range scenarios {
+		// Given
+		f := path.Join(dir, "rules.hcl")
+		assert.NoError(t, ioutil.WriteFile(f, []byte(content), 0600))
+
+		// When
+		_, err := LoadDetectorRulesFile(f)
+
+		// Then
+		if assert.Error(t, err, content) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
+
+func TestMasker_Mask_StreamedRulesFileSensitiveData(t *testing.T) {
+	// Given some input content and user defined rules ...
+	ctx, stdinSim, stdoutSim := defaultTestMaskOpts(t)
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	rules, err := LoadDetectorRulesFile("test-data/rules/rules.hcl")
+	assert.NoError(t, err)
+	ctx.Detectors = []Detector{NewRuleDetector(rules)}
+	m := NewMasker(ctx, nil)
+
+	// When we simulate piping this content (which contains
+	// organisation specific secrets) into stdIn
+	stdinSim.write(
+		`
+      + api_key = "ikey_0123456789abcdef"
+      + sas_url = "https://acc.blob.core.windows.net/c?sv=2020-08-04&sig=Ab12%2Bcd%3D&se=2030"
+      + legacy  = "ltok-1234"`)
+	err = m.Mask()
+
+	// Then the secret spans should be masked, or replaced as per the rule
+	assert.NoError(t, err)
+	b := stdoutSim.getAllContent()
+	assert.Equal(t,
+		`
+      + api_key = "******"
+      + sas_url = "https://acc.blob.core.windows.net/c?sv=2020-08-04&sig=REDACTED&se=2030"
+      + legacy  = "ltok-1234"`, b)
+}
@@ -0,0 +1,113 @@
+package terrahelp
+
+import (
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SelectionRules narrows down which of the values found in a tfvars
+// file are considered sensitive. The zero value selects every value.
+type SelectionRules struct {
+	// IncludeVars holds variable name globs (e.g. *_password), if any
+	// are supplied only variables matching at least one are selected
+	IncludeVars []string
+	// ExcludeVars holds variable name globs which are never selected
+	ExcludeVars []string
+	// MinLength is the minimum length (in characters) a value must have to be selected
+	MinLength int
+	// SkipNonSecret excludes values which are obviously not secrets such
+	// as booleans, numbers, region names, IP addresses and CIDRs
+	SkipNonSecret bool
+}
+
+var nonSecretPatterns = []*regexp.Regexp{
+	// AWS regions e.g. eu-west-1, us-gov-west-1
+	regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d$`),
+	// AWS availability zones e.g. eu-west-1a
+	regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-\d[a-z]$`),
+	// GCP regions and zones e.g. europe-west2, us-central1-a
+	regexp.MustCompile(`^(africa|asia|australia|europe|me|northamerica|southamerica|us)-[a-z]+\d(-[a-z])?$`),
+}
+
+var nonSecretWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true,
+	"on": true, "off": true, "enabled": true, "disabled": true,
+	"null": true, "none": true,
+	// Azure regions
+	"eastus": true, "eastus2": true, "westus": true, "westus2": true, "westus3": true,
+	"centralus": true, "northcentralus": true, "southcentralus": true,
+	"northeurope": true, "westeurope": true, "uksouth": true, "ukwest": true,
+	"francecentral": true, "germanywestcentral": true, "swedencentral": true,
+	"southeastasia": true, "eastasia": true, "japaneast": true, "japanwest": true,
+	"australiaeast": true, "australiasoutheast": true, "canadacentral": true,
+}
+
+// IsNonSecretValue returns true if the value is one which is obviously
+// not a secret, e.g. a boolean, number, region name, IP address or CIDR
+func IsNonSecretValue(v string) bool {
+	s := strings.TrimSpace(v)
+	if nonSecretWords[strings.ToLower(s)] {
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	for _, r := range nonSecretPatterns {
+		if r.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectsVariable returns true if values of the named variable
+// should be considered sensitive
+func (r *SelectionRules) SelectsVariable(name string) bool {
+	if r == nil {
+		return true
+	}
+	for _, g := range r.ExcludeVars {
+		if globMatch(g, name) {
+			return false
+		}
+	}
+	if len(r.IncludeVars) == 0 {
+		return true
+	}
+	for _, g := range r.IncludeVars {
+		if globMatch(g, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectsValue returns true if the value itself passes the
+// configured value based heuristics
+func (r *SelectionRules) SelectsValue(v string) bool {
+	if r == nil {
+		return true
+	}
+	if utf8.RuneCountInString(v) < r.MinLength {
+		return false
+	}
+	if r.SkipNonSecret && IsNonSecretValue(v) {
+		return false
+	}
+	return true
+}
+
+func globMatch(pattern, name string) bool {
+	m, err := path.Match(pattern, name)
+	return err == nil && m
+}
@@ -0,0 +1,36 @@
+package terrahelp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNonSecretValue(t *testing.T) {
+	nonSecrets := []string{"true", "False", "off", "42", "3.14", "eu-west-1", "us-gov-west-1",
+		"eu-west-1a", "europe-west2", "us-central1-a", "westeurope", "10.0.0.0/16", "192.168.0.1", "::1"}
+	secrets := []string{"sensitive-value-1-AK#%DJGHS*G", "madeup-aws-secret-key-KGSDGH", "hunter2", "eu-west-1-secret"}
+
+	for _, v := range nonSecrets {
+		assert.True(t, IsNonSecretValue(v), "expected %s to be a non secret", v)
+	}
+	for _, v := range secrets {
+		assert.False(t, IsNonSecretValue(v), "expected %s to be a possible secret", v)
+	}
+}
+
+func TestSelectionRules_NilSelectsEverything(t *testing.T) {
+	var r *SelectionRules
+
+	assert.True(t, r.SelectsVariable("anything"))
+	assert.True(t, r.SelectsValue("true"))
+}
+
+func TestSelectionRules_SelectsValue_MinLengthCountsCharacters(t *testing.T) {
+	r := &SelectionRules{MinLength: 5}
+
+	// "päßwö" is 5 characters but 8 bytes, whereas "pääß" is 4 characters but 7 bytes
+	assert.True(t, r.SelectsValue("päßwö"))
+	assert.False(t, r.SelectsValue("pääß"))
+	assert.False(t, r.SelectsValue("abcd"))
+}
@@ -0,0 +1,273 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// tfVarEnvPrefix is the prefix of environment variables
+// terraform uses to set input variables
+const tfVarEnvPrefix = "TF_VAR_"
+
+// EnvReplaceables provides the sensitive values set via TF_VAR_
+// environment variables
+type EnvReplaceables struct {
+	excludeWhitespaceOnly bool
+	rules                 *SelectionRules
+	environ               func() []string
+}
+
+// NewEnvReplaceables creates a new EnvReplaceables, only considering
+// values passing the SelectionRules as sensitive
+func NewEnvReplaceables(excl bool, r *SelectionRules) *EnvReplaceables {
+	return &EnvReplaceables{excludeWhitespaceOnly: excl, rules: r, environ: os.Environ}
+}
+
+// Values returns the sensitive values set via TF_VAR_ environment variables
+func (e *EnvReplaceables) Values() ([]string, error) {
+	svs, err := e.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns the sensitive values set via TF_VAR_ environment
+// variables, along with the terraform variable each one sets
+func (e *EnvReplaceables) SourcedValues() ([]SourcedValue, error) {
+	var svs []SourcedValue
+	for _, kv := range e.environ() {
+		if !strings.HasPrefix(kv, tfVarEnvPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(kv, tfVarEnvPrefix), "=", 2)
+		if len(parts) != 2 || !e.rules.SelectsVariable(parts[0]) {
+			continue
+		}
+		v := parts[1]
+		if v == "" || (e.excludeWhitespaceOnly && strings.TrimSpace(v) == "") || !e.rules.SelectsValue(v) {
+			continue
+		}
+		svs = append(svs, SourcedValue{Value: v, Source: "env", Variable: "var." + parts[0]})
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// TfstateOutputsReplaceables provides the values of the outputs marked as
+// sensitive within a tfstate file, and optionally those of the sensitive
+// resource attributes
+type TfstateOutputsReplaceables struct {
+	filename   string
+	encrypter  Encrypter
+	key        string
+	attributes bool
+}
+
+// NewTfstateOutputsReplaceables creates a new TfstateOutputsReplaceables
+// based on the provided tfstate filename
+func NewTfstateOutputsReplaceables(f string) *TfstateOutputsReplaceables {
+	return &TfstateOutputsReplaceables{filename: f}
+}
+
+// WithDecryption configures the TfstateOutputsReplaceables to transparently
+// decrypt (in memory only) a fully or inline encrypted tfstate file, using
+// the Encrypter and key
+func (t *TfstateOutputsReplaceables) WithDecryption(e Encrypter, key string) *TfstateOutputsReplaceables {
+	t.encrypter = e
+	t.key = key
+	return t
+}
+
+// WithSensitiveAttributes configures the TfstateOutputsReplaceables to additionally
+// provide the values of the resource attributes recorded as sensitive (which only
+// terraform 0.15+ records) e.g. those derived from sensitive variables
+func (t *TfstateOutputsReplaceables) WithSensitiveAttributes() *TfstateOutputsReplaceables {
+	t.attributes = true
+	return t
+}
+
+type tfstateOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Value     interface{} `json:"value"`
+}
+
+type tfstateOutputs struct {
+	// Outputs as held in version 4 (terraform 0.12+) state
+	Outputs map[string]tfstateOutput `json:"outputs"`
+	// Modules as held in version 3 (pre terraform 0.12) state
+	Modules []struct {
+		Outputs map[string]tfstateOutput `json:"outputs"`
+	} `json:"modules"`
+	Resources []tfstateResource `json:"resources"`
+}
+
+type tfstateResource struct {
+	Module    string `json:"module"`
+	Mode      string `json:"mode"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Instances []struct {
+		IndexKey   interface{}            `json:"index_key"`
+		Attributes map[string]interface{} `json:"attributes"`
+		// SensitiveAttributes holds the path (e.g. get_attr password) to each sensitive attribute
+		SensitiveAttributes [][]tfstatePathStep `json:"sensitive_attributes"`
+	} `json:"instances"`
+}
+
+type tfstatePathStep struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Values returns the values of the sensitive outputs within the tfstate file
+func (t *TfstateOutputsReplaceables) Values() ([]string, error) {
+	svs, err := t.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns the values of the sensitive outputs within
+// the tfstate file, along with the output each one came from
+func (t *TfstateOutputsReplaceables) SourcedValues() ([]SourcedValue, error) {
+	b, err := ioutil.ReadFile(t.filename)
+	if err != nil {
+		return nil, err
+	}
+	b, err = decryptContent(t.filename, b, t.encrypter, t.key)
+	if err != nil {
+		return nil, err
+	}
+	state := &tfstateOutputs{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("Unable to parse tfstate file %s : %s", t.filename, err)
+	}
+
+	all := []map[string]tfstateOutput{state.Outputs}
+	for _, m := range state.Modules {
+		all = append(all, m.Outputs)
+	}
+
+	var svs []SourcedValue
+	for _, outputs := range all {
+		names := make([]string, 0, len(outputs))
+		for n := range outputs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if !outputs[n].Sensitive {
+				continue
+			}
+			for _, l := range stringLeaves("output."+n, outputs[n].Value) {
+				svs = append(svs, SourcedValue{Value: l.Value, Source: "tfstate:" + t.filename, Variable: l.Variable})
+			}
+		}
+	}
+	if t.attributes {
+		for _, l := range sensitiveAttributes(state.Resources) {
+			svs = append(svs, SourcedValue{Value: l.Value, Source: "tfstate:" + t.filename, Variable: l.Variable})
+		}
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// sensitiveAttributes returns the non empty string values held within the resource
+// attributes recorded as sensitive, along with the path (e.g. aws_db_instance.db.password)
+// to each
+func sensitiveAttributes(resources []tfstateResource) []SourcedValue {
+	var leaves []SourcedValue
+	for _, r := range resources {
+		addr := r.Type + "." + r.Name
+		if r.Mode == "data" {
+			addr = "data." + addr
+		}
+		if r.Module != "" {
+			addr = r.Module + "." + addr
+		}
+		for _, inst := range r.Instances {
+			iaddr := addr
+			switch k := inst.IndexKey.(type) {
+			case float64:
+				iaddr = fmt.Sprintf("%s[%d]", addr, int(k))
+			case string:
+				iaddr = fmt.Sprintf("%s[%q]", addr, k)
+			}
+			for _, steps := range inst.SensitiveAttributes {
+				if path, v, ok := attributeAt(iaddr, inst.Attributes, steps); ok {
+					leaves = append(leaves, stringLeaves(path, v)...)
+				}
+			}
+		}
+	}
+	return leaves
+}
+
+// attributeAt returns the value found by following the (sensitive attribute) path
+// steps through the attributes, along with its path
+func attributeAt(path string, attrs map[string]interface{}, steps []tfstatePathStep) (string, interface{}, bool) {
+	var v interface{} = attrs
+	for _, st := range steps {
+		key := st.Value
+		if st.Type == "index" {
+			// Index steps hold the key as a typed value e.g. {"value": 0, "type": "number"}
+			if m, ok := st.Value.(map[string]interface{}); ok {
+				key = m["value"]
+			}
+		}
+		switch k := key.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return "", nil, false
+			}
+			if v, ok = m[k]; !ok {
+				return "", nil, false
+			}
+			if st.Type == "get_attr" {
+				path += "." + k
+			} else {
+				path += fmt.Sprintf("[%q]", k)
+			}
+		case float64:
+			l, ok := v.([]interface{})
+			if !ok || int(k) < 0 || int(k) >= len(l) {
+				return "", nil, false
+			}
+			v = l[int(k)]
+			path += fmt.Sprintf("[%d]", int(k))
+		default:
+			return "", nil, false
+		}
+	}
+	return path, v, true
+}
+
+// stringLeaves returns the non empty string values held anywhere within
+// the (decoded JSON like) value, along with the path to each
+func stringLeaves(path string, v interface{}) []SourcedValue {
+	var leaves []SourcedValue
+	switch t := v.(type) {
+	case string:
+		if t != "" {
+			leaves = append(leaves, SourcedValue{Value: t, Variable: path})
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			leaves = append(leaves, stringLeaves(p, t[k])...)
+		}
+	case []interface{}:
+		for i, e := range t {
+			leaves = append(leaves, stringLeaves(fmt.Sprintf("%s[%d]", path, i), e)...)
+		}
+	}
+	return leaves
+}
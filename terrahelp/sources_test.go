@@ -0,0 +1,115 @@
+package terrahelp
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvReplaceables_SourcedValues(t *testing.T) {
+	// Given
+	env := NewEnvReplaceables(true, &SelectionRules{ExcludeVars: []string{"*_id"}, SkipNonSecret: true})
+	env.environ = func() []string {
+		return []string{
+			"HOME=/home/someone",
+			"TF_VAR_db_password=db-password-HDKSJ",
+			"TF_VAR_account_id=account-KSDJH",
+			"TF_VAR_region=eu-west-1",
+			"TF_VAR_blank=   ",
+			"TF_VAR_conn=user=admin;pass=secret-KSJD",
+		}
+	}
+
+	// When
+	svs, err := env.SourcedValues()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "user=admin;pass=secret-KSJD", Source: "env", Variable: "var.conn"},
+		{Value: "db-password-HDKSJ", Source: "env", Variable: "var.db_password"},
+	}, svs)
+}
+
+func TestTfstateOutputsReplaceables_Values(t *testing.T) {
+	// Given
+	r := NewTfstateOutputsReplaceables("test-data/sources/terraform.tfstate")
+
+	// When
+	vals, err := r.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api-key-primary-JSDK", "api-key-other-KSJD", "db-password-HDKSJ"}, vals)
+}
+
+func TestTfstateOutputsReplaceables_SourcedValues_SensitiveAttributes(t *testing.T) {
+	// Given an earlier tfstate file recording the sensitive resource attributes
+	f := "test-data/sources/terraform-attributes.tfstate"
+	r := NewTfstateOutputsReplaceables(f).WithSensitiveAttributes()
+
+	// When
+	svs, err := r.SourcedValues()
+
+	// Then the values of the sensitive attributes are provided along with the outputs
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "token-value-PSKDJ", Source: "tfstate:" + f, Variable: "module.app.aws_ssm_parameter.tokens[0].values[0]"},
+		{Value: "db-password-OLDKS", Source: "tfstate:" + f, Variable: "aws_db_instance.db.password"},
+		{Value: "db-password-HDKSJ", Source: "tfstate:" + f, Variable: "output.db_password"},
+		{Value: "tag-secret-WJDKS", Source: "tfstate:" + f, Variable: `module.app.aws_ssm_parameter.tokens[0].tags["secret"]`},
+	}, svs)
+
+	// And only the outputs are provided unless asked for
+	vals, err := NewTfstateOutputsReplaceables(f).Values()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db-password-HDKSJ"}, vals)
+}
+
+func TestTfstateOutputsReplaceables_SourcedValues_Version3(t *testing.T) {
+	// Given
+	r := NewTfstateOutputsReplaceables("test-data/sources/terraform-v3.tfstate")
+
+	// When
+	svs, err := r.SourcedValues()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "legacy-token-SJDHK", Source: "tfstate:test-data/sources/terraform-v3.tfstate", Variable: "output.token"},
+	}, svs)
+}
+
+func TestTfstateOutputsReplaceables_Values_InvalidState(t *testing.T) {
+	// Given
+	r := NewTfstateOutputsReplaceables("test-data/selection/terraform.tfvars")
+
+	// When
+	_, err := r.Values()
+
+	// Then
+	assert.EqualError(t, err, "Unable to parse tfstate file test-data/selection/terraform.tfvars : invalid character '#' looking for beginning of value")
+}
+
+func TestTfstateOutputsReplaceables_Values_EncryptedState(t *testing.T) {
+	// Given an earlier, fully encrypted, tfstate file
+	b, err := ioutil.ReadFile("test-data/sources/terraform-v3.tfstate")
+	assert.NoError(t, err)
+	key := testSimpleKey
+	f, err := ioutil.TempFile("", "encrypted-tfstate")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(mustEncrypt(t, NewSimpleEncrypter(), key, string(b)))
+	assert.NoError(t, err)
+	f.Close()
+	r := NewTfstateOutputsReplaceables(f.Name()).WithDecryption(NewSimpleEncrypter(), key)
+
+	// When
+	vals, err := r.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"legacy-token-SJDHK"}, vals)
+}
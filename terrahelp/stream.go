@@ -0,0 +1,109 @@
+package terrahelp
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	// streamReadSize is the size of each read from a streamed input
+	streamReadSize = 32 * 1024
+	// maxStreamLineLen is the length at which a line, with no newline in sight,
+	// is processed in part rather than carried over in its entirety
+	maxStreamLineLen = 64 * 1024
+	// maxANSIEscapeLen bounds the length of an ANSI escape sequence, so
+	// one is not split when a long line is processed in part
+	maxANSIEscapeLen = 32
+)
+
+// streamingTransformable is implemented by Transformables whose content can
+// be processed incrementally, as it is read, rather than all at once
+type streamingTransformable interface {
+	Transformable
+	stream() (io.Reader, io.Writer)
+}
+
+func (p *StreamTransformable) stream() (io.Reader, io.Writer) {
+	return p.in, p.out
+}
+
+// segmentTransform transforms the next segment of streamed content, which is
+// made up of whole lines unless it is the final one. It returns the output for
+// the part of the segment which can no longer be affected by what follows it,
+// and the (untransformed) rest which is carried over to the next segment.
+type segmentTransform func(seg string, final bool) (out string, carry string, err error)
+
+// transformStream reads the input incrementally, writing the transformed
+// output of each segment (flushing it if possible) as soon as it is known
+func transformStream(in io.Reader, out io.Writer, f segmentTransform) error {
+	return transformSegments(in, out, segmentEnd, f)
+}
+
+// transformSegments is transformStream, with the end of each
+// segment of the data read so far determined by end
+func transformSegments(in io.Reader, out io.Writer, end func(data string, eof bool) int, f segmentTransform) error {
+	buf := make([]byte, streamReadSize)
+	carry := ""
+	for {
+		n, rerr := in.Read(buf)
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		eof := rerr == io.EOF
+		if n == 0 && !eof {
+			continue
+		}
+
+		data := carry + string(buf[:n])
+		cut := end(data, eof)
+		o, c, err := f(data[:cut], eof && cut == len(data))
+		if err != nil {
+			return err
+		}
+		carry = c + data[cut:]
+		if o != "" {
+			if _, err := io.WriteString(out, o); err != nil {
+				return err
+			}
+			if fl, ok := out.(interface{ Flush() error }); ok {
+				if err := fl.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// segmentEnd returns where the segment of data ready to be transformed
+// ends, i.e. after its last whole line
+func segmentEnd(data string, eof bool) int {
+	if eof {
+		return len(data)
+	}
+	if i := strings.LastIndexByte(data, '\n'); i >= 0 {
+		return i + 1
+	}
+	if len(data) < maxStreamLineLen {
+		return 0
+	}
+	// A very long line, process as much as possible
+	return liveSegmentEnd(data, eof)
+}
+
+// liveSegmentEnd returns where the segment of data ready to be transformed ends,
+// which is all of it, including any partial line (e.g. an interactive prompt),
+// so long as no ANSI escape sequence is split
+func liveSegmentEnd(data string, eof bool) int {
+	if eof {
+		return len(data)
+	}
+	if i := strings.LastIndexByte(data, '\x1b'); i >= 0 && i >= len(data)-maxANSIEscapeLen {
+		if loc := ansiEscapeRegExp.FindStringIndex(data[i:]); loc == nil || loc[0] != 0 || i+loc[1] == len(data) {
+			return i
+		}
+	}
+	return len(data)
+}
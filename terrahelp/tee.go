@@ -0,0 +1,130 @@
+package terrahelp
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TeeTimestamp is replaced, within the name of the file the encrypted copy
+// is written to (see MaskOpts.TeeEncryptedFilename), by the (UTC) time the
+// masking started, e.g. apply-{{timestamp}}.log.enc
+const TeeTimestamp = "{{timestamp}}"
+
+const teeTimestampFormat = "20060102T150405Z"
+
+// teeStderr is the stream the raw copy of the stderr of a command run by exec is
+// kept for, which is written to its own file, named as per the stdout copy with
+// the stream appended, e.g. apply.log.enc.stderr
+const teeStderr = "stderr"
+
+// teeFile writes the raw (unmasked) content of a stream out encrypted in the binary
+// format, buffering it until a full chunk (binaryChunkSize) has been written to it,
+// which is then encrypted and written out on a line of its own. Any partial chunk is
+// written out when closed, so all the content read is kept should masking fail part
+// way through, while each (e.g. vault) encryption covers as much content as possible.
+type teeFile struct {
+	mu        sync.Mutex
+	f         *os.File
+	buf       []byte
+	encrypter Encrypter
+	key       string
+}
+
+func newTeeFile(filename string, e Encrypter, key string) (*teeFile, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &teeFile{f: f, encrypter: e, key: key}, nil
+}
+
+func (t *teeFile) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	for len(t.buf) >= binaryChunkSize {
+		if err := t.flush(binaryChunkSize); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush encrypts, and writes out, the first n bytes of the buffered content
+func (t *teeFile) flush(n int) error {
+	enc, err := t.encrypter.Encrypt(t.key, t.buf[:n])
+	if err != nil {
+		return err
+	}
+	if _, err = t.f.Write(append(enc, '\n')); err != nil {
+		return err
+	}
+	t.buf = append(t.buf[:0], t.buf[n:]...)
+	return nil
+}
+
+// Close writes out any partial chunk and closes the file, which may be called more than once
+func (t *teeFile) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return nil
+	}
+	var err error
+	if len(t.buf) > 0 {
+		err = t.flush(len(t.buf))
+	}
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	t.f = nil
+	return err
+}
+
+// teeFilename returns the name of the file the encrypted copy is written
+// to, given masking started at the time
+func (m *MaskOpts) teeFilename(t time.Time) string {
+	return strings.Replace(m.TeeEncryptedFilename, TeeTimestamp, t.UTC().Format(teeTimestampFormat), -1)
+}
+
+// openTee opens the file the raw copy of the stream (the content masked,
+// or "stderr" for the stderr of a command) is written to
+func (m *Masker) openTee(stream string) error {
+	name := m.teeFilename
+	if stream != "" {
+		name += "." + stream
+	}
+	t, err := newTeeFile(name, m.encrypter, m.key)
+	if err != nil {
+		return err
+	}
+	if m.tees == nil {
+		m.tees = map[string]*teeFile{}
+	}
+	m.tees[stream] = t
+	return nil
+}
+
+// teeReader returns a reader which, as it reads the content of the stream,
+// keeps a raw copy of it when teeing
+func (m *Masker) teeReader(stream string, in io.Reader) io.Reader {
+	t, ok := m.tees[stream]
+	if !ok {
+		return in
+	}
+	return io.TeeReader(in, t)
+}
+
+// closeTee closes the encrypted copies of the content, if teeing
+func (m *Masker) closeTee() error {
+	var err error
+	for _, t := range m.tees {
+		if cerr := t.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package terrahelp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const teeTestContent = `~ password = "old-secret-DJSKH" -> "sensitive-value-1-AK#%DJGHS*G"
++ secret   = "madeup-aws-secret-key-KGSDGH"
+`
+
+func readTee(t *testing.T, filename string) string {
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatBinary)
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	plain, err := h.decryptBytes(ctx, b)
+	assert.NoError(t, err)
+	return string(plain)
+}
+
+func TestMasker_Mask_TeeEncrypted(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	var out bytes.Buffer
+	ctx := NewDefaultMaskOpts()
+	ctx.ReplacePrevVals = false
+	ctx.TeeEncryptedFilename = filepath.Join(dir, "apply-"+TeeTimestamp+".log.enc")
+	ctx.TransformItems = []Transformable{NewStreamTransformable(strings.NewReader(teeTestContent), &out)}
+	m := NewMasker(ctx, NewTfVars(exampleTestTfvars, true)).
+		WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When
+	err = m.Mask()
+
+	// Then the content is masked, and the raw content written out encrypted
+	assert.NoError(t, err)
+	assert.Equal(t, `~ password = "old-secret-DJSKH" -> "******"
++ secret   = "******"
+`, out.String())
+	files, err := filepath.Glob(filepath.Join(dir, "apply-*.log.enc"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	b, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "madeup-aws-secret-key-KGSDGH")
+	assert.Equal(t, teeTestContent, readTee(t, files[0]))
+}
+
+func TestMasker_Mask_TeeEncryptedFile(t *testing.T) {
+	// Given a file, which is not streamed as previous values are detected
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "apply.log")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(teeTestContent), 0600))
+	ctx := NewDefaultMaskOpts()
+	ctx.TeeEncryptedFilename = filepath.Join(dir, "apply.log.enc")
+	ctx.TransformItems = []Transformable{NewFileTransformable(file, false, "")}
+	m := NewMasker(ctx, NewTfVars(exampleTestTfvars, true)).
+		WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When
+	err = m.Mask()
+
+	// Then
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "old-secret-DJSKH")
+	assert.Equal(t, teeTestContent, readTee(t, ctx.TeeEncryptedFilename))
+}
+
+func TestMasker_Mask_TeeEncryptedMaskingFails(t *testing.T) {
+	// Given content whose reading fails part way through
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := NewDefaultMaskOpts()
+	ctx.TeeEncryptedFilename = filepath.Join(dir, "apply.log.enc")
+	in := io.MultiReader(strings.NewReader(teeTestContent), iotest.ErrReader(errors.New("read failed")))
+	ctx.TransformItems = []Transformable{NewStreamTransformable(in, &bytes.Buffer{})}
+	m := NewMasker(ctx, NewTfVars(exampleTestTfvars, true)).
+		WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When
+	err = m.Mask()
+
+	// Then the encrypted copy still holds the content read before it failed
+	assert.EqualError(t, err, "read failed")
+	assert.Equal(t, teeTestContent, readTee(t, ctx.TeeEncryptedFilename))
+}
+
+func TestMasker_Mask_TeeEncryptedRequiresProvider(t *testing.T) {
+	// Given
+	ctx := NewDefaultMaskOpts()
+	ctx.TeeEncryptedFilename = "apply.log.enc"
+	ctx.TransformItems = []Transformable{NewStreamTransformable(strings.NewReader(teeTestContent), &bytes.Buffer{})}
+
+	// When
+	err := NewMasker(ctx, nil).Mask()
+
+	// Then
+	assert.EqualError(t, err, "An encryption provider is required to tee an encrypted copy of the content")
+}
+
+func TestTeeFile_Write(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "terrahelp-tee")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "apply.log.enc")
+	tf, err := newTeeFile(filename, NewSimpleEncrypter(), testSimpleKey)
+	assert.NoError(t, err)
+
+	// When the content is written a line at a time, filling more than a chunk
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < 1025; i++ {
+		_, err = tf.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tf.Close())
+
+	// Then it is encrypted a full chunk at a time, the rest when closed
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "\n"))
+	assert.Equal(t, strings.Repeat(line, 1025), readTee(t, filename))
+}
+
+func TestMaskOpts_teeFilename(t *testing.T) {
+	ctx := &MaskOpts{TeeEncryptedFilename: "logs/apply-" + TeeTimestamp + ".log.enc"}
+	at := time.Date(2023, 4, 1, 10, 5, 9, 0, time.FixedZone("CET", 3600))
+	assert.Equal(t, "logs/apply-20230401T090509Z.log.enc", ctx.teeFilename(at))
+}
@@ -0,0 +1,355 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTerragruntFilename is the name of the terragrunt config file
+const DefaultTerragruntFilename = "terragrunt.hcl"
+
+// TerragruntReplaceables provides the sensitive values passed to terraform
+// as inputs within a terragrunt config file, including those inherited
+// from any included (parent) config files.
+//
+// Only literal values and a subset of the terragrunt functions (get_env,
+// find_in_parent_folders, get_terragrunt_dir, sops_decrypt_file, jsondecode
+// and yamldecode) along with locals are evaluated, inputs which can not be
+// evaluated (e.g. those referencing dependency outputs) are ignored.
+type TerragruntReplaceables struct {
+	filename              string
+	excludeWhitespaceOnly bool
+	rules                 *SelectionRules
+	lookupEnv             func(string) (string, bool)
+	sopsDecrypt           func(string) ([]byte, error)
+}
+
+// NewTerragruntReplaceables creates a new TerragruntReplaceables based on the
+// provided terragrunt config filename, only considering inputs passing the
+// SelectionRules as sensitive
+func NewTerragruntReplaceables(f string, excl bool, r *SelectionRules) *TerragruntReplaceables {
+	return &TerragruntReplaceables{
+		filename:              f,
+		excludeWhitespaceOnly: excl,
+		rules:                 r,
+		lookupEnv:             os.LookupEnv,
+		sopsDecrypt:           sopsDecryptFile,
+	}
+}
+
+// Values returns the sensitive values of the terragrunt inputs
+func (t *TerragruntReplaceables) Values() ([]string, error) {
+	svs, err := t.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns the sensitive values of the terragrunt inputs, along
+// with the config file and terraform variable each one came from
+func (t *TerragruntReplaceables) SourcedValues() ([]SourcedValue, error) {
+	inputs, err := t.inputs(t.filename, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(inputs))
+	for n := range inputs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var svs []SourcedValue
+	for _, n := range names {
+		if !t.rules.SelectsVariable(n) {
+			continue
+		}
+		in := inputs[n]
+		for _, l := range stringLeaves("var."+n, in.value) {
+			if t.excludeWhitespaceOnly && strings.TrimSpace(l.Value) == "" {
+				continue
+			}
+			if !t.rules.SelectsValue(l.Value) {
+				continue
+			}
+			svs = append(svs, SourcedValue{Value: l.Value, Source: "terragrunt:" + in.filename, Variable: l.Variable})
+		}
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// terragruntInput is the (decoded JSON like) value of a single input,
+// along with the config file it was set in
+type terragruntInput struct {
+	filename string
+	value    interface{}
+}
+
+// inputs returns the evaluated inputs of the config file, merged over
+// those of the config files it includes
+func (t *TerragruntReplaceables) inputs(f string, visited map[string]bool) (map[string]terragruntInput, error) {
+	abs, err := filepath.Abs(f)
+	if err != nil {
+		return nil, err
+	}
+	if visited[abs] {
+		return nil, fmt.Errorf("Terragrunt config %s is included more than once", f)
+	}
+	visited[abs] = true
+
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(b, f, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("Unable to parse terragrunt config %s : %s", f, diags.Error())
+	}
+	body := file.Body.(*hclsyntax.Body)
+	ctx := t.evalContext(f, body)
+
+	merged := map[string]terragruntInput{}
+	for _, blk := range body.Blocks {
+		if blk.Type != "include" {
+			continue
+		}
+		attr, ok := blk.Body.Attributes["path"]
+		if !ok {
+			continue
+		}
+		p, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() || p.IsNull() || !p.IsKnown() || p.Type() != cty.String {
+			return nil, fmt.Errorf("Unable to evaluate the include path within terragrunt config %s", f)
+		}
+		parent := p.AsString()
+		if !filepath.IsAbs(parent) {
+			parent = filepath.Join(filepath.Dir(f), parent)
+		}
+		inherited, err := t.inputs(parent, visited)
+		if err != nil {
+			return nil, err
+		}
+		for n, in := range inherited {
+			merged[n] = in
+		}
+	}
+
+	if attr, ok := body.Attributes["inputs"]; ok {
+		for n, v := range evalObjectItems(attr.Expr, ctx) {
+			merged[n] = terragruntInput{filename: f, value: v}
+		}
+	}
+	return merged, nil
+}
+
+// evalObjectItems evaluates each of the items of an object expression
+// independently, so that those which can not be evaluated are skipped
+// without affecting the rest
+func evalObjectItems(expr hclsyntax.Expression, ctx *hcl.EvalContext) map[string]interface{} {
+	items := map[string]interface{}{}
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		v, diags := expr.Value(ctx)
+		if diags.HasErrors() || !v.CanIterateElements() {
+			return items
+		}
+		if m, ok := ctyToGo(v).(map[string]interface{}); ok {
+			items = m
+		}
+		return items
+	}
+	for _, item := range obj.Items {
+		k, diags := item.KeyExpr.Value(ctx)
+		if diags.HasErrors() || !k.IsKnown() || k.IsNull() || k.Type() != cty.String {
+			continue
+		}
+		if nested, ok := item.ValueExpr.(*hclsyntax.ObjectConsExpr); ok {
+			items[k.AsString()] = evalObjectItems(nested, ctx)
+			continue
+		}
+		v, diags := item.ValueExpr.Value(ctx)
+		if diags.HasErrors() {
+			continue
+		}
+		items[k.AsString()] = ctyToGo(v)
+	}
+	return items
+}
+
+// ctyToGo converts a wholly known cty value to its decoded JSON like form,
+// returning nil for values which are unknown or can not be converted
+func ctyToGo(v cty.Value) interface{} {
+	if !v.IsWhollyKnown() {
+		return nil
+	}
+	b, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return nil
+	}
+	var i interface{}
+	if err := json.Unmarshal(b, &i); err != nil {
+		return nil
+	}
+	return i
+}
+
+// evalContext returns the context used to evaluate the expressions
+// within the config file, including any locals it defines
+func (t *TerragruntReplaceables) evalContext(f string, body *hclsyntax.Body) *hcl.EvalContext {
+	dir, _ := filepath.Abs(filepath.Dir(f))
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{},
+		Functions: map[string]function.Function{
+			"get_env":                t.getEnvFunc(),
+			"find_in_parent_folders": findInParentFoldersFunc(dir),
+			"get_terragrunt_dir":     constStringFunc(dir),
+			"sops_decrypt_file":      t.sopsDecryptFileFunc(dir),
+			"jsondecode":             stdlib.JSONDecodeFunc,
+			"jsonencode":             stdlib.JSONEncodeFunc,
+			"yamldecode":             yamlDecodeFunc,
+			"lower":                  stdlib.LowerFunc,
+			"upper":                  stdlib.UpperFunc,
+			"format":                 stdlib.FormatFunc,
+			"merge":                  stdlib.MergeFunc,
+			"trimspace":              stdlib.TrimSpaceFunc,
+		},
+	}
+
+	var pending []*hclsyntax.Attribute
+	for _, blk := range body.Blocks {
+		if blk.Type == "locals" {
+			for _, attr := range blk.Body.Attributes {
+				pending = append(pending, attr)
+			}
+		}
+	}
+	// Locals may refer to one another, so keep evaluating those
+	// outstanding until no further progress can be made
+	locals := map[string]cty.Value{}
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		ctx.Variables["local"] = cty.ObjectVal(locals)
+		var remaining []*hclsyntax.Attribute
+		for _, attr := range pending {
+			v, diags := attr.Expr.Value(ctx)
+			if diags.HasErrors() {
+				remaining = append(remaining, attr)
+				continue
+			}
+			locals[attr.Name] = v
+			progress = true
+		}
+		pending = remaining
+	}
+	ctx.Variables["local"] = cty.ObjectVal(locals)
+	return ctx
+}
+
+func (t *TerragruntReplaceables) getEnvFunc() function.Function {
+	return function.New(&function.Spec{
+		Params:   []function.Parameter{{Name: "name", Type: cty.String}},
+		VarParam: &function.Parameter{Name: "default", Type: cty.String},
+		Type:     function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if v, ok := t.lookupEnv(args[0].AsString()); ok {
+				return cty.StringVal(v), nil
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return cty.StringVal(""), nil
+		},
+	})
+}
+
+func findInParentFoldersFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		VarParam: &function.Parameter{Name: "args", Type: cty.String},
+		Type:     function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			name := DefaultTerragruntFilename
+			if len(args) > 0 {
+				name = args[0].AsString()
+			}
+			for d := filepath.Dir(dir); ; d = filepath.Dir(d) {
+				p := filepath.Join(d, name)
+				if _, err := os.Stat(p); err == nil {
+					return cty.StringVal(p), nil
+				}
+				if d == filepath.Dir(d) {
+					break
+				}
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return cty.NilVal, fmt.Errorf("Could not find a %s in any of the parent folders of %s", name, dir)
+		},
+	})
+}
+
+func constStringFunc(s string) function.Function {
+	return function.New(&function.Spec{
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(s), nil
+		},
+	})
+}
+
+func (t *TerragruntReplaceables) sopsDecryptFileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			p := args[0].AsString()
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			b, err := t.sopsDecrypt(p)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			return cty.StringVal(string(b)), nil
+		},
+	})
+}
+
+var yamlDecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "src", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var i interface{}
+		if err := yaml.Unmarshal([]byte(args[0].AsString()), &i); err != nil {
+			return cty.NilVal, err
+		}
+		b, err := json.Marshal(i)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return stdlib.JSONDecode(cty.StringVal(string(b)))
+	},
+})
+
+// sopsDecryptFile decrypts the file using the sops CLI
+func sopsDecryptFile(f string) ([]byte, error) {
+	out, err := exec.Command("sops", "-d", f).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("Unable to decrypt %s with sops : %s", f, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, fmt.Errorf("Unable to decrypt %s with sops : %s", f, err)
+	}
+	return out, nil
+}
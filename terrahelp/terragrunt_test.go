@@ -0,0 +1,82 @@
+package terrahelp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTerragruntReplaceables(f string, r *SelectionRules, env map[string]string) *TerragruntReplaceables {
+	tg := NewTerragruntReplaceables(f, true, r)
+	tg.lookupEnv = func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	tg.sopsDecrypt = ioutil.ReadFile
+	return tg
+}
+
+func TestTerragruntReplaceables_SourcedValues(t *testing.T) {
+	// Given
+	tg := newTestTerragruntReplaceables("test-data/terragrunt/app/terragrunt.hcl", nil,
+		map[string]string{"TEST_TG_DB_PASSWORD": "env-db-password-KSDJH"})
+
+	// When
+	svs, err := tg.SourcedValues()
+
+	// Then
+	child := "terragrunt:test-data/terragrunt/app/terragrunt.hcl"
+	parent, _ := filepath.Abs("test-data/terragrunt/terragrunt.hcl")
+	assert.NoError(t, err)
+	assert.Equal(t, []SourcedValue{
+		{Value: "sops-signing-key-2-SKDJ", Source: child, Variable: "var.api.signing[1]"},
+		{Value: "sops-signing-key-1-DJSK", Source: child, Variable: "var.api.signing[0]"},
+		{Value: "org-token-default-SJDHK", Source: "terragrunt:" + parent, Variable: "var.org_api_token"},
+		{Value: "env-db-password-KSDJH", Source: child, Variable: "var.db_password"},
+		{Value: "sops-api-key-KSJDH", Source: child, Variable: "var.api.key"},
+		{Value: "app-service", Source: child, Variable: "var.name"},
+	}, svs)
+}
+
+func TestTerragruntReplaceables_Values_Selection(t *testing.T) {
+	// Given
+	tg := newTestTerragruntReplaceables("test-data/terragrunt/app/terragrunt.hcl",
+		&SelectionRules{IncludeVars: []string{"*_password", "*_token"}},
+		map[string]string{"TEST_TG_ORG_API_TOKEN": "env-org-token-DKSJ"})
+
+	// When
+	vals, err := tg.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"env-org-token-DKSJ"}, vals)
+}
+
+func TestTerragruntReplaceables_Values_SopsError(t *testing.T) {
+	// Given
+	tg := newTestTerragruntReplaceables("test-data/terragrunt/app/terragrunt.hcl", nil, nil)
+	tg.sopsDecrypt = func(f string) ([]byte, error) {
+		return nil, fmt.Errorf("no key available")
+	}
+
+	// When
+	vals, err := tg.Values()
+
+	// Then the inputs depending on the sops secrets are skipped
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org-token-default-SJDHK", "app-service"}, vals)
+}
+
+func TestTerragruntReplaceables_Values_InvalidConfig(t *testing.T) {
+	// Given
+	tg := newTestTerragruntReplaceables("test-data/terragrunt/app/secrets.enc.yaml", nil, nil)
+
+	// When
+	_, err := tg.Values()
+
+	// Then
+	assert.Error(t, err)
+}
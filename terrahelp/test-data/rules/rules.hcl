@@ -0,0 +1,16 @@
+# Organisation specific masking rules
+rule "internal-api-key" {
+  description = "Internal API keys"
+  regex       = "ikey_[A-Za-z0-9]{16}"
+}
+
+rule "azure-sas-signature" {
+  regex       = "sig=([A-Za-z0-9%]+)"
+  capture     = 1
+  replacement = "REDACTED"
+}
+
+rule "legacy-token" {
+  regex    = "ltok-[0-9]+"
+  disabled = true
+}
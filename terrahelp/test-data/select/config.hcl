@@ -0,0 +1,16 @@
+# Some config
+db_password = "s3cr3t-\"quoted\"-KJSD"
+db_port     = 5432
+
+inputs = {
+  api_key = "api-key-HDKSJ"
+  names   = ["first-JSKD", "second-SKDJ"]
+  ref     = "${local.value}"
+}
+
+resource "aws_db_instance" "db" {
+  password = <<EOT
+heredoc-secret-DKSJ
+EOT
+  username = "admin"
+}
@@ -0,0 +1,25 @@
+include {
+  path = find_in_parent_folders()
+}
+
+dependency "vpc" {
+  config_path = "../vpc"
+}
+
+locals {
+  secrets = yamldecode(sops_decrypt_file("secrets.enc.yaml"))
+  prefix  = "app"
+  name    = "${local.prefix}-service"
+}
+
+inputs = {
+  name        = local.name
+  db_password = get_env("TEST_TG_DB_PASSWORD")
+  replicas    = 3
+  vpc_id      = dependency.vpc.outputs.vpc_id
+  api = {
+    key     = local.secrets.api_key
+    signing = local.secrets.signing_keys
+  }
+  whitespace = "   "
+}
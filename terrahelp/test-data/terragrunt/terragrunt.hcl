@@ -0,0 +1,13 @@
+# Parent terragrunt config, included by app/terragrunt.hcl
+remote_state {
+  backend = "s3"
+  config = {
+    bucket = "terraform-state-bucket"
+    key    = "${path_relative_to_include()}/terraform.tfstate"
+  }
+}
+
+inputs = {
+  org_api_token = get_env("TEST_TG_ORG_API_TOKEN", "org-token-default-SJDHK")
+  db_password   = "parent-db-password-overridden"
+}
@@ -0,0 +1,140 @@
+package terrahelp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonArrayElem stands for any element of an array within the path to a JSON value,
+// and jsonAnyKey for any key of an object
+const (
+	jsonArrayElem = "[]"
+	jsonAnyKey    = "*"
+)
+
+// tfstateValuePaths are the paths within tfstate, beneath which the string values
+// are encrypted in tfstate mode, i.e. resource attributes and outputs, for both
+// version 4 (terraform 0.12+) and version 3 (pre terraform 0.12) state
+var tfstateValuePaths = [][]string{
+	{"resources", jsonArrayElem, "instances", jsonArrayElem, "attributes"},
+	{"resources", jsonArrayElem, "instances", jsonArrayElem, "attributes_flat"},
+	{"outputs", jsonAnyKey, "value"},
+	{"modules", jsonArrayElem, "resources", jsonAnyKey, "primary", "attributes"},
+	{"modules", jsonArrayElem, "outputs", jsonAnyKey, "value"},
+}
+
+// TfstateMode returns true if the Encryption mode is 'tfstate'
+func (o *CryptoHandlerOpts) TfstateMode() bool {
+	return o.EncMode == ThEncryptModeTfstate
+}
+
+// encryptTfstate encrypts the sensitive values within the string values of the resource
+// attributes and outputs of the tfstate. Values are matched once decoded, so JSON escaping
+// is never split, and each changed string is re-encoded (as terraform would) in place,
+// so the tfstate remains valid JSON, with its formatting untouched.
+func (t *CryptoHandler) encryptTfstate(ctx *CryptoHandlerOpts, plain []byte) ([]byte, error) {
+	if err := checkNotEncrypted(ctx, plain); err != nil {
+		return nil, err
+	}
+	if !json.Valid(plain) {
+		return nil, fmt.Errorf("Unable to encrypt in %s mode, the content is not valid JSON", ThEncryptModeTfstate)
+	}
+
+	creds, err := ctx.sensitiveValues(t.replaceables(ctx), string(plain))
+	if err != nil {
+		return nil, err
+	}
+	r := NewReplacer(values(creds))
+	counts := map[string]int{}
+	enc := t.encryption(ctx, creds, counts)
+	out, err := transformJSONStrings(string(plain), tfstateValue, func(v string) (string, error) {
+		return r.Replace(v, enc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.logReplacements("encrypted", counts)
+	return []byte(out), nil
+}
+
+// decryptTfstate decrypts the encrypted values within the string values of the
+// tfstate, re-encoding each in place so the tfstate remains valid JSON
+func (t *CryptoHandler) decryptTfstate(b []byte, key string) ([]byte, error) {
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("Unable to decrypt in %s mode, the content is not valid JSON", ThEncryptModeTfstate)
+	}
+	out, err := transformJSONStrings(string(b), func([]string) bool { return true }, func(v string) (string, error) {
+		dec, err := t.decryptInline([]byte(v), key)
+		return string(dec), err
+	})
+	return []byte(out), err
+}
+
+// tfstateValue returns true if the value at the path is held beneath
+// the resource attributes or outputs of the tfstate
+func tfstateValue(path []string) bool {
+	for _, p := range tfstateValuePaths {
+		if jsonPathHasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonPathHasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if p != jsonAnyKey && p != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// transformJSONStrings applies f to the (decoded) string values (not keys) of the
+// (valid) JSON document whose path matches, replacing those changed by f with their
+// JSON encoding, and leaving the rest of the document as is
+func transformJSONStrings(doc string, match func(path []string) bool, f func(string) (string, error)) (string, error) {
+	var sb strings.Builder
+	last := 0
+	err := walkJSONStrings(doc, func(path []string, start, end int) error {
+		if !match(path) {
+			return nil
+		}
+		var v string
+		if err := json.Unmarshal([]byte(doc[start:end]), &v); err != nil {
+			return err
+		}
+		nv, err := f(v)
+		if err != nil || nv == v {
+			return err
+		}
+		enc, err := json.Marshal(nv)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(doc[last:start])
+		sb.Write(enc)
+		last = end
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(doc[last:])
+	return sb.String(), nil
+}
+
+// walkJSONStrings calls f with the path to, and the start and end offsets of,
+// each string value (not key) within the (valid) JSON document, the path holding
+// the key of each object, and jsonArrayElem for each array, the value is within
+func walkJSONStrings(doc string, f func(path []string, start, end int) error) error {
+	root, err := parseJSONDocument(doc)
+	if err != nil {
+		return err
+	}
+	return root.walkStrings(nil, f)
+}
@@ -1,7 +1,10 @@
 package terrahelp
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
+	"regexp"
 
 	"sort"
 	"strings"
@@ -35,6 +38,15 @@ func (d *DefaultReplaceables) Values() ([]string, error) {
 type Tfvars struct {
 	filename              string
 	excludeWhitespaceOnly bool
+	rules                 *SelectionRules
+	encrypter             Encrypter
+	key                   string
+}
+
+// tfvar holds the string values found for a single top level variable
+type tfvar struct {
+	name string
+	vals []string
 }
 
 // NewTfVars creates a new Tfvars holder based on the provided filename
@@ -42,24 +54,146 @@ func NewTfVars(f string, excl bool) *Tfvars {
 	return &Tfvars{filename: f, excludeWhitespaceOnly: excl}
 }
 
+// NewTfVarsWithSelection creates a new Tfvars holder based on the provided
+// filename, which only considers values passing the SelectionRules as sensitive
+func NewTfVarsWithSelection(f string, excl bool, r *SelectionRules) *Tfvars {
+	return &Tfvars{filename: f, excludeWhitespaceOnly: excl, rules: r}
+}
+
+// WithDecryption configures the Tfvars to transparently decrypt (in memory only)
+// a fully or inline encrypted tfvars file, using the Encrypter and key
+func (t *Tfvars) WithDecryption(e Encrypter, key string) *Tfvars {
+	t.encrypter = e
+	t.key = key
+	return t
+}
+
 // Values returns a list of the sensitive values
 // which were detected in the provided tfvars file
 func (t *Tfvars) Values() ([]string, error) {
+	vars, err := t.variables()
+	if err != nil {
+		return nil, err
+	}
+
+	var vals []string
+	for _, tv := range vars {
+		vals = append(vals, tv.vals...)
+	}
+
+	// Reverse in case there are overlaps
+	sort.Strings(vals)
+	for i := len(vals)/2 - 1; i >= 0; i-- {
+		opp := len(vals) - 1 - i
+		vals[i], vals[opp] = vals[opp], vals[i]
+	}
+
+	return vals, nil
+}
+
+// SourcedValues returns a list of the sensitive values which were detected
+// in the provided tfvars file, along with the variable each came from
+func (t *Tfvars) SourcedValues() ([]SourcedValue, error) {
+	vars, err := t.variables()
+	if err != nil {
+		return nil, err
+	}
+
+	var svs []SourcedValue
+	for _, tv := range vars {
+		for _, v := range tv.vals {
+			svs = append(svs, SourcedValue{Value: v, Source: "tfvars:" + t.filename, Variable: "var." + tv.name})
+		}
+	}
+	return orderSourcedValues(svs), nil
+}
+
+// SelectedVariables returns the sorted names of the variables which
+// have at least one value considered sensitive
+func (t *Tfvars) SelectedVariables() ([]string, error) {
+	vars, err := t.variables()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, tv := range vars {
+		if len(tv.vals) > 0 {
+			names = append(names, tv.name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// variables parses the tfvars file, returning each top level
+// variable along with the sensitive values found within it
+func (t *Tfvars) variables() ([]tfvar, error) {
 	// Read tfvars file
 	b, err := ioutil.ReadFile(t.filename)
 	if err != nil {
 		return nil, err
 	}
+	return t.parseVariables(b)
+}
+
+// parseVariables parses the (possibly encrypted) tfvars content, returning
+// each top level variable along with the sensitive values found within it
+func (t *Tfvars) parseVariables(b []byte) ([]tfvar, error) {
+	b, err := decryptContent(t.filename, b, t.encrypter, t.key)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse it
 	astFile, err := hcl.ParseBytes(b)
 	if err != nil {
 		return nil, err
 	}
+	list, ok := astFile.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("Unable to parse %s, expected a list of variables", t.filename)
+	}
+
+	var vars []tfvar
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			continue
+		}
+		name := fmt.Sprint(item.Keys[0].Token.Value())
+		if !t.rules.SelectsVariable(name) {
+			continue
+		}
+		vars = append(vars, tfvar{name: name, vals: t.sensitiveVals(item.Val)})
+	}
+	return vars, nil
+}
 
-	// Find sensitive values (all quoted value strings)
+// decryptContent returns the plaintext content of the named file, decrypting
+// it first should it have been fully or inline encrypted
+func decryptContent(name string, b []byte, e Encrypter, key string) ([]byte, error) {
+	r := regexp.MustCompile(thCryptoWrapRegExp)
+	loc := r.FindIndex(b)
+	if loc == nil {
+		return b, nil
+	}
+	if e == nil {
+		return nil, fmt.Errorf("%s is encrypted, an encryption provider is required to decrypt it", name)
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	if loc = r.FindIndex(trimmed); loc[0] == 0 && loc[1] == len(trimmed) {
+		return e.Decrypt(key, trimmed)
+	}
+	h := &CryptoHandler{Encrypter: e}
+	return h.decryptInline(b, key)
+}
+
+// sensitiveVals finds the sensitive values (all quoted value strings)
+// held within the node
+func (t *Tfvars) sensitiveVals(n ast.Node) []string {
 	var vals []string
-	ast.Walk(astFile, func(node ast.Node) (ast.Node, bool) {
+	ast.Walk(n, func(node ast.Node) (ast.Node, bool) {
 		if node == nil {
 			return node, false
 		}
@@ -69,24 +203,23 @@ func (t *Tfvars) Values() ([]string, error) {
 			switch n.Token.Type {
 			case token.STRING:
 				v := n.Token.Value().(string)
-				if v != "" && t.excludeWhitespaceOnly && strings.TrimSpace(v) != "" {
-					vals = append(vals, n.Token.Value().(string))
-				}
-				if v != "" && !t.excludeWhitespaceOnly {
-					vals = append(vals, n.Token.Value().(string))
+				if t.isSensitive(v) {
+					vals = append(vals, v)
 				}
 			}
 		}
 
 		return node, true
 	})
+	return vals
+}
 
-	// Reverse in case there are overlaps
-	sort.Strings(vals)
-	for i := len(vals)/2 - 1; i >= 0; i-- {
-		opp := len(vals) - 1 - i
-		vals[i], vals[opp] = vals[opp], vals[i]
+func (t *Tfvars) isSensitive(v string) bool {
+	if v == "" {
+		return false
 	}
-
-	return vals, nil
+	if t.excludeWhitespaceOnly && strings.TrimSpace(v) == "" {
+		return false
+	}
+	return t.rules.SelectsValue(v)
 }
@@ -1,6 +1,9 @@
 package terrahelp
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -182,3 +185,138 @@ func TestTfvars_ExtractSensitiveValsWithOnlyWhitespace_WithConfigExclWhitespaceF
 	}
 
 }
+
+func TestTfvars_Values_IncludeVarsSelectsByName(t *testing.T) {
+	// Given
+	tu := NewTfVarsWithSelection("test-data/selection/terraform.tfvars", true,
+		&SelectionRules{IncludeVars: []string{"*_password", "*_token"}})
+
+	// When
+	actual, err := tu.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"selected-db-password-HJSKD",
+		"selected-api-token-OWJFN",
+		"admin-password-KDJS"}, actual)
+}
+
+func TestTfvars_Values_ExcludeVarsOverridesInclude(t *testing.T) {
+	// Given
+	tu := NewTfVarsWithSelection("test-data/selection/terraform.tfvars", true,
+		&SelectionRules{IncludeVars: []string{"*_password"}, ExcludeVars: []string{"admin_*"}})
+
+	// When
+	actual, err := tu.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"selected-db-password-HJSKD"}, actual)
+}
+
+func TestTfvars_Values_MinLengthAndSkipNonSecret(t *testing.T) {
+	// Given
+	tu := NewTfVarsWithSelection("test-data/selection/terraform.tfvars", true,
+		&SelectionRules{MinLength: 4, SkipNonSecret: true})
+
+	// When
+	actual, err := tu.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"selected-db-password-HJSKD",
+		"selected-api-token-OWJFN",
+		"admin-password-KDJS"}, actual)
+}
+
+func TestTfvars_SelectedVariables(t *testing.T) {
+	// Given
+	tu := NewTfVarsWithSelection("test-data/selection/terraform.tfvars", true,
+		&SelectionRules{ExcludeVars: []string{"*_password"}, SkipNonSecret: true})
+
+	// When
+	actual, err := tu.SelectedVariables()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api_token", "short_secret"}, actual)
+}
+
+func encryptedTestTfvars(t *testing.T, e Encrypter, key string, inline bool) string {
+	b, err := ioutil.ReadFile("test-data/example-project/original/terraform.tfvars")
+	if err != nil {
+		t.Fatalf("Unable to read test tfvars : %s", err)
+	}
+	if inline {
+		b = []byte(strings.Replace(string(b), "madeup-aws-secret-key-KGSDGH",
+			string(mustEncrypt(t, e, key, "madeup-aws-secret-key-KGSDGH")), -1))
+	} else {
+		b = mustEncrypt(t, e, key, string(b))
+	}
+	f, err := ioutil.TempFile("", "encrypted-tfvars")
+	if err != nil {
+		t.Fatalf("Unable to create encrypted test tfvars : %s", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(b); err != nil {
+		t.Fatalf("Unable to write encrypted test tfvars : %s", err)
+	}
+	return f.Name()
+}
+
+func mustEncrypt(t *testing.T, e Encrypter, key, s string) []byte {
+	b, err := e.Encrypt(key, []byte(s))
+	if err != nil {
+		t.Fatalf("Unable to encrypt : %s", err)
+	}
+	return b
+}
+
+func TestTfvars_Values_EncryptedTfvars(t *testing.T) {
+	for _, inline := range []bool{false, true} {
+		// Given a fully or inline encrypted tfvars file
+		key := testSimpleKey
+		f := encryptedTestTfvars(t, NewSimpleEncrypter(), key, inline)
+		defer os.Remove(f)
+		tu := NewTfVars(f, true).WithDecryption(NewSimpleEncrypter(), key)
+
+		// When
+		actual, err := tu.Values()
+
+		// Then
+		assert.NoError(t, err)
+		assert.Contains(t, actual, "madeup-aws-access-key-PEJFNS")
+		assert.Contains(t, actual, "madeup-aws-secret-key-KGSDGH")
+	}
+}
+
+func TestTfvars_SelectedVariables_EncryptedTfvars(t *testing.T) {
+	// Given an encrypted tfvars file
+	key := testSimpleKey
+	f := encryptedTestTfvars(t, NewSimpleEncrypter(), key, false)
+	defer os.Remove(f)
+	tu := NewTfVarsWithSelection(f, true, &SelectionRules{IncludeVars: []string{"pretend_aws_*"}, SkipNonSecret: true}).
+		WithDecryption(NewSimpleEncrypter(), key)
+
+	// When
+	actual, err := tu.SelectedVariables()
+
+	// Then the variables are selected from the decrypted content
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pretend_aws_access_key", "pretend_aws_secret_key"}, actual)
+}
+
+func TestTfvars_Values_EncryptedTfvarsWithoutDecryption(t *testing.T) {
+	// Given an encrypted tfvars file, but no means to decrypt it
+	f := encryptedTestTfvars(t, NewSimpleEncrypter(), testSimpleKey, false)
+	defer os.Remove(f)
+	tu := NewTfVars(f, true)
+
+	// When
+	_, err := tu.Values()
+
+	// Then
+	assert.EqualError(t, err, f+" is encrypted, an encryption provider is required to decrypt it")
+}
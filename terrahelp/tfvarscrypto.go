@@ -0,0 +1,92 @@
+package terrahelp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// encryptedValueRegExp matches a value which is wholly encrypted
+var encryptedValueRegExp = regexp.MustCompile("^" + thCryptoWrapRegExp + "$")
+
+// TfvarsFormat returns true if the content is to be encrypted as a tfvars file
+func (o *CryptoHandlerOpts) TfvarsFormat() bool {
+	return o.Format == ThEncryptFormatTfvars
+}
+
+// tfvarsValue is the source, from start to end, of a string value within a tfvars file
+type tfvarsValue struct {
+	variable   string
+	start, end int
+}
+
+// encryptTfvars encrypts the string values of the (selected) variables within the tfvars
+// file in place, leaving the variable names, object keys, comments and formatting as they
+// are. Each value is encrypted as it is written (i.e. the escaped content of a quoted
+// string, or the body of a heredoc), so decrypting the file inline restores it byte for
+// byte, and the encrypted file can be used, as is, as the source of the sensitive values.
+// Values which are already encrypted are left as they are, so newly added values can be
+// encrypted by encrypting the file again.
+func (t *CryptoHandler) encryptTfvars(ctx *CryptoHandlerOpts, name string, plain []byte) ([]byte, error) {
+	src := string(plain)
+	root, err := parseHCLDocument(name, src)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s as %s : %s", name, ThEncryptFormatTfvars, err)
+	}
+
+	var vals []tfvarsValue
+	for i, v := range root.keys {
+		if !ctx.Selection.SelectsVariable(v) {
+			continue
+		}
+		for _, n := range root.children[i].strings() {
+			start, end := tfvarsValueContent(src, n)
+			if ctx.selectsTfvarsValue(n.value) && !encryptedValueRegExp.MatchString(src[start:end]) {
+				vals = append(vals, tfvarsValue{variable: v, start: start, end: end})
+			}
+		}
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i].start < vals[j].start })
+
+	key := ctx.EncryptionKey()
+	counts := map[string]int{}
+	var sb strings.Builder
+	last := 0
+	for _, v := range vals {
+		ct, err := t.Encrypter.Encrypt(key, []byte(src[v.start:v.end]))
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(src[last:v.start])
+		sb.Write(ct)
+		last = v.end
+		counts["var."+v.variable]++
+	}
+	sb.WriteString(src[last:])
+	ctx.logReplacements("encrypted", counts)
+	return []byte(sb.String()), nil
+}
+
+// selectsTfvarsValue returns true if the (non empty) string value of a tfvars variable
+// is to be encrypted, as it would be considered sensitive were it in the tfvars source
+func (o *CryptoHandlerOpts) selectsTfvarsValue(v string) bool {
+	if v == "" || (o.ExcludeWhitespaceOnly && strings.TrimSpace(v) == "") {
+		return false
+	}
+	return o.Selection.SelectsValue(v)
+}
+
+// tfvarsValueContent returns where the content of the string, i.e. within its
+// quotes, or the body of a heredoc (excluding its final newline), starts and ends
+func tfvarsValueContent(src string, n *docNode) (int, int) {
+	if !strings.HasPrefix(src[n.start:], "<<") {
+		return n.start + 1, n.end - 1
+	}
+	start := n.start + strings.IndexByte(src[n.start:n.end], '\n') + 1
+	end := n.start + strings.LastIndexByte(src[n.start:n.end], '\n')
+	if end < start {
+		return start, start
+	}
+	return start, start + len(strings.TrimSuffix(src[start:end], "\r"))
+}
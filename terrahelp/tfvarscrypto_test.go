@@ -0,0 +1,142 @@
+package terrahelp
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+)
+
+const tfvarsCryptoTestFile = "test-data/tfvars/terraform.tfvars"
+
+func readTfvarsCryptoTest(t *testing.T) []byte {
+	b, err := ioutil.ReadFile(tfvarsCryptoTestFile)
+	if err != nil {
+		t.Fatalf("Unable to read test tfvars : %s", err)
+	}
+	return b
+}
+
+func TestCryptoHandler_encryptTfvars(t *testing.T) {
+	// Given
+	plain := readTfvarsCryptoTest(t)
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptTfvars(defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars), tfvarsCryptoTestFile, plain)
+
+	// Then each string value is encrypted, with the variable names, object keys,
+	// comments, formatting and non string values left as they are
+	assert.NoError(t, err)
+	assert.Equal(t, 8, encryptedCount(enc))
+	_, diags := hclsyntax.ParseConfig(enc, tfvarsCryptoTestFile, hcl.Pos{Line: 1, Column: 1})
+	assert.False(t, diags.HasErrors())
+	s := string(enc)
+	for _, v := range []string{"eu-west-1", "HJSKD", "dev-secret-KSJDH", "token-two-JSHDK", "MIIEvQIBADANBgkqhkiG9w0BAQEFAASCBKcw", "Welcome"} {
+		assert.NotContains(t, s, v)
+	}
+	for _, v := range []string{
+		"#      structure preserving encryption of tfvars files\n",
+		"db_password = \"@terrahelp-encrypted(",
+		")\" # escaped, kept as written\n",
+		"\ninstance_count = 3\nenable_logging = true\nempty          = \"\"\n",
+		"/* Credentials by environment */\ncredentials = {\n\t\"dev.user\" = \"@terrahelp-encrypted(",
+		"\n\tprod       = \"@terrahelp-encrypted(",
+		"private_key = <<EOT\n@terrahelp-encrypted(",
+		")\nEOT\n",
+		"motd = <<-EOT\n@terrahelp-encrypted(",
+		")\n    EOT\n",
+	} {
+		assert.Contains(t, s, v)
+	}
+}
+
+func TestCryptoHandler_decryptTfvars(t *testing.T) {
+	// Given
+	plain := readTfvarsCryptoTest(t)
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars)
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	enc, err := h.encryptTfvars(ctx, tfvarsCryptoTestFile, plain)
+	assert.NoError(t, err)
+
+	// When
+	dec, err := h.decryptBytes(ctx, enc)
+
+	// Then the tfvars file is restored exactly
+	assert.NoError(t, err)
+	assert.Equal(t, string(plain), string(dec))
+}
+
+func TestCryptoHandler_encryptTfvars_AlreadyEncryptedValues(t *testing.T) {
+	// Given a tfvars file with a newly added value, double encryption being disabled
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars)
+	ctx.AllowDoubleEncrypt = false
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	enc, err := h.encryptTfvars(ctx, tfvarsCryptoTestFile, readTfvarsCryptoTest(t))
+	assert.NoError(t, err)
+	added := string(enc) + "api_key = \"new-api-key-WKSJD\"\n"
+
+	// When
+	reenc, err := h.encryptTfvars(ctx, tfvarsCryptoTestFile, []byte(added))
+
+	// Then only the new value is encrypted
+	assert.NoError(t, err)
+	assert.Equal(t, 9, encryptedCount(reenc))
+	assert.True(t, strings.HasPrefix(string(reenc), string(enc)))
+	assert.NotContains(t, string(reenc), "new-api-key-WKSJD")
+}
+
+func TestCryptoHandler_encryptTfvars_Selection(t *testing.T) {
+	// Given
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars)
+	ctx.Selection = &SelectionRules{IncludeVars: []string{"*password", "credentials"}}
+	h := &CryptoHandler{NewSimpleEncrypter()}
+
+	// When
+	enc, err := h.encryptTfvars(ctx, tfvarsCryptoTestFile, readTfvarsCryptoTest(t))
+
+	// Then only the values of the selected variables are encrypted
+	assert.NoError(t, err)
+	assert.Equal(t, 3, encryptedCount(enc))
+	assert.Contains(t, string(enc), `"eu-west-1"`)
+	assert.Contains(t, string(enc), "token-one-PQKDS")
+}
+
+func TestCryptoHandler_encryptTfvars_Invalid(t *testing.T) {
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	_, err := h.encryptTfvars(defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars), "broken.tfvars", []byte("region = \"eu-west-1\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unable to parse broken.tfvars as tfvars")
+
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars)
+	ctx.Format = "yaml"
+	assert.EqualError(t, h.Encrypt(ctx), "Unknown format yaml specified, expected tfvars, plan or binary")
+}
+
+func TestTfvars_Values_TfvarsEncryptedTfvars(t *testing.T) {
+	// Given a tfvars file encrypted in the tfvars format
+	ctx := defaultTestSimpleCryptoHandlerOpts(ThEncryptModeFull, ThEncryptFormatTfvars)
+	h := &CryptoHandler{NewSimpleEncrypter()}
+	enc, err := h.encryptTfvars(ctx, tfvarsCryptoTestFile, readTfvarsCryptoTest(t))
+	assert.NoError(t, err)
+	f, err := ioutil.TempFile("", "tfvars-encrypted-tfvars")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(enc)
+	assert.NoError(t, err)
+	f.Close()
+	expected, err := NewTfVars(tfvarsCryptoTestFile, true).Values()
+	assert.NoError(t, err)
+
+	// When
+	actual, err := NewTfVars(f.Name(), true).WithDecryption(NewSimpleEncrypter(), ctx.SimpleKey).Values()
+
+	// Then it provides the same sensitive values as the plaintext tfvars file
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Contains(t, actual, "prod-secret-OWJDN")
+}
@@ -0,0 +1,185 @@
+package terrahelp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"regexp"
+)
+
+// DefaultTokenMapFilename is the default file the (encrypted)
+// token to value mapping is written to when tokenizing
+const DefaultTokenMapFilename = "terrahelp.tokens"
+
+// tokenMapVersion identifies the format of the token mapping
+const tokenMapVersion = 1
+
+// Tokens are of the form <th-token:{run id}-{n}>, the run id
+// keeping the tokens of different runs apart
+const (
+	tokenFormat = "<th-token:%s-%d>"
+	tokenRegExp = `<th-token:[0-9a-f]{8}-\d+>`
+)
+
+// TokenMap holds the sensitive value each token replaced
+type TokenMap struct {
+	Version int               `json:"version"`
+	Tokens  map[string]string `json:"tokens"`
+}
+
+// tokenizer hands out a unique token for each sensitive value, the
+// same value always being given the same token
+type tokenizer struct {
+	run    string
+	tokens map[string]string
+	values map[string]string
+}
+
+func newTokenizer() (*tokenizer, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return &tokenizer{run: hex.EncodeToString(b), tokens: map[string]string{}, values: map[string]string{}}, nil
+}
+
+// token returns the token for the value
+func (t *tokenizer) token(v string) string {
+	if tok, ok := t.tokens[v]; ok {
+		return tok
+	}
+	tok := fmt.Sprintf(tokenFormat, t.run, len(t.tokens)+1)
+	t.tokens[v] = tok
+	t.values[tok] = v
+	return tok
+}
+
+// write encrypts and writes out the token mapping to the file
+func (t *tokenizer) write(filename string, e Encrypter, key string) error {
+	b, err := json.MarshalIndent(TokenMap{Version: tokenMapVersion, Tokens: t.values}, "", "  ")
+	if err != nil {
+		return err
+	}
+	enc, err := e.Encrypt(key, b)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, enc, 0600)
+}
+
+// ReadTokenMap reads and decrypts the token mapping held in the file
+func ReadTokenMap(filename string, e Encrypter, key string) (*TokenMap, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := e.Decrypt(key, bytes.TrimSpace(b))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt the token mapping %s : %s", filename, err)
+	}
+	tm := &TokenMap{}
+	if err := json.Unmarshal(plain, tm); err != nil {
+		return nil, fmt.Errorf("Unable to read the token mapping %s : %s", filename, err)
+	}
+	if tm.Version != tokenMapVersion {
+		return nil, fmt.Errorf("Unsupported version %d of the token mapping %s", tm.Version, filename)
+	}
+	return tm, nil
+}
+
+// Unmasker exposes the ability to restore tokenized content (see MaskOpts.Tokenize)
+// back to its original form, using the token mapping written when masking it
+type Unmasker struct {
+	ctx       *UnmaskOpts
+	encrypter Encrypter
+}
+
+// UnmaskOpts holds the specific options detailing how, and on what
+// to perform the unmasking action.
+type UnmaskOpts struct {
+	*TransformOpts
+	ProviderOpts
+	TokenMapFilename string
+}
+
+// NewDefaultUnmaskOpts creates UnmaskOpts with all the
+// default values set
+func NewDefaultUnmaskOpts() *UnmaskOpts {
+	return &UnmaskOpts{
+		TransformOpts:    &TransformOpts{},
+		ProviderOpts:     ProviderOpts{EncProvider: ThEncryptProviderSimple, NamedEncKey: ThNamedEncryptionKey},
+		TokenMapFilename: DefaultTokenMapFilename,
+	}
+}
+
+// NewUnmasker creates a new Unmasker with the specified options, and
+// the Encrypter used to decrypt the token mapping
+func NewUnmasker(ctx *UnmaskOpts, e Encrypter) *Unmasker {
+	return &Unmasker{ctx: ctx, encrypter: e}
+}
+
+// Unmask will ensure each token within the input content is
+// replaced with the sensitive value it stands for
+func (u *Unmasker) Unmask() error {
+	if len(u.ctx.TransformItems) == 0 {
+		log.Printf("No piped input detected, nor any files provided to unmask\n")
+		return nil
+	}
+
+	for _, ci := range u.ctx.TransformItems {
+		if err := ci.validate(); err != nil {
+			log.Printf("Not a valid item for unmasking: %v\n", err)
+			return err
+		}
+	}
+
+	tm, err := ReadTokenMap(u.ctx.TokenMapFilename, u.encrypter, u.ctx.EncryptionKey())
+	if err != nil {
+		return err
+	}
+	toks := make([]string, 0, len(tm.Tokens))
+	for tok := range tm.Tokens {
+		toks = append(toks, tok)
+	}
+	r := NewReplacer(toks)
+	f := func(i int) (string, error) { return tm.Tokens[toks[i]], nil }
+
+	for _, ci := range u.ctx.TransformItems {
+		if err := u.unmask(ci, r, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Unmasker) unmask(t Transformable, r *Replacer, f func(int) (string, error)) error {
+	if err := t.beforeTransform(); err != nil {
+		return err
+	}
+
+	if st, ok := t.(streamingTransformable); ok {
+		in, out := st.stream()
+		return transformStream(in, out, func(seg string, final bool) (string, string, error) {
+			return r.ReplacePrefix(seg, final, f)
+		})
+	}
+	in, err := t.read()
+	if err != nil {
+		return err
+	}
+	out, err := r.Replace(string(in), f)
+	if err != nil {
+		return err
+	}
+	if u.ctx.Debug {
+		if unknown := regexp.MustCompile(tokenRegExp).FindAllString(out, -1); len(unknown) > 0 {
+			log.Printf("%d tokens not found in the token mapping %s\n", len(unknown), u.ctx.TokenMapFilename)
+		}
+	}
+	return t.write([]byte(out))
+}
@@ -0,0 +1,99 @@
+package terrahelp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasker_Mask_TokenizeAndUnmask(t *testing.T) {
+	// Given a plan output file, holding a changed sensitive value
+	dir, err := ioutil.TempDir("", "terrahelp-tokenize")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	original := `~ password = "old-secret-DJSKH" -> "sensitive-value-1-AK#%DJGHS*G"
++ secret   = "madeup-aws-secret-key-KGSDGH"
++ again    = "madeup-aws-secret-key-KGSDGH"
+`
+	file := filepath.Join(dir, "plan.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(original), 0600))
+	tokens := filepath.Join(dir, "plan.tokens")
+
+	ctx := NewDefaultMaskOpts()
+	ctx.Tokenize = true
+	ctx.TokenMapFilename = tokens
+	ctx.TransformItems = []Transformable{NewFileTransformable(file, false, "")}
+	m := NewMasker(ctx, NewTfVars(exampleTestTfvars, true)).
+		WithEncryption(NewSimpleEncrypter(), testSimpleKey)
+
+	// When tokenized
+	err = m.Mask()
+
+	// Then each value (including the previous one) is replaced by its own token
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	masked := string(b)
+	assert.NotContains(t, masked, "secret-")
+	toks := regexp.MustCompile(tokenRegExp).FindAllString(masked, -1)
+	assert.Len(t, toks, 4)
+	assert.NotEqual(t, toks[0], toks[1])
+	assert.Equal(t, toks[2], toks[3])
+
+	// and the token mapping is encrypted
+	enc, err := ioutil.ReadFile(tokens)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(enc), "secret-")
+	tm, err := ReadTokenMap(tokens, NewSimpleEncrypter(), testSimpleKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "madeup-aws-secret-key-KGSDGH", tm.Tokens[toks[2]])
+
+	// When unmasked
+	uctx := NewDefaultUnmaskOpts()
+	uctx.SimpleKey = testSimpleKey
+	uctx.TokenMapFilename = tokens
+	uctx.TransformItems = []Transformable{NewFileTransformable(file, false, "")}
+	err = NewUnmasker(uctx, NewSimpleEncrypter()).Unmask()
+
+	// Then the original content is restored
+	assert.NoError(t, err)
+	b, err = ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, original, string(b))
+}
+
+func TestMasker_Mask_TokenizeRequiresEncrypter(t *testing.T) {
+	// Given
+	ctx, stdinSim, stdoutSim := defaultTestMaskOpts(t)
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	ctx.Tokenize = true
+
+	// When
+	err := NewMasker(ctx, &DefaultReplaceables{[]string{"sensitive"}}).Mask()
+
+	// Then
+	assert.EqualError(t, err, "An encryption provider is required to tokenize, in order to encrypt the token mapping")
+}
+
+func TestUnmasker_Unmask_WrongKey(t *testing.T) {
+	// Given a token mapping encrypted with a different key
+	dir, err := ioutil.TempDir("", "terrahelp-tokenize")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokens := filepath.Join(dir, "plan.tokens")
+	tk, err := newTokenizer()
+	assert.NoError(t, err)
+	tk.token("sensitive")
+	assert.NoError(t, tk.write(tokens, NewSimpleEncrypter(), testSimpleKey))
+
+	// When
+	_, err = ReadTokenMap(tokens, NewSimpleEncrypter(), "AES256Key-32Characters1234567890")
+
+	// Then
+	assert.Error(t, err)
+}
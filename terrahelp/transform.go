@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
 )
 
 // TransformOpts holds the specific options detailing how, and on what
@@ -13,6 +14,55 @@ import (
 type TransformOpts struct {
 	TransformItems []Transformable
 	TfvarsFilename string
+	Selection      *SelectionRules
+	Detectors      []Detector
+	// EncodedVariants additionally replaces the common encoded
+	// forms (base64, URL, JSON and HCL escaped) of sensitive values
+	EncodedVariants bool
+	// Debug logs (to stderr) how many occurrences of each
+	// sensitive value were replaced, and where it came from
+	Debug bool
+}
+
+// sensitiveValues returns the sensitive values to replace within the content,
+// i.e. those provided by the Replaceables, plus any found by the Detectors
+// along with their encoded variants (if configured)
+func (o *TransformOpts) sensitiveValues(r Replaceables, content string) ([]SourcedValue, error) {
+	return o.sensitiveValuesDetectedBy(r, o.Detectors, content)
+}
+
+// sensitiveValuesDetectedBy returns the sensitive values to replace within the
+// content, as per sensitiveValues, but using the supplied detectors
+func (o *TransformOpts) sensitiveValuesDetectedBy(r Replaceables, ds []Detector, content string) ([]SourcedValue, error) {
+	svs, err := sourcedValues(r)
+	if err != nil {
+		return nil, err
+	}
+	dets, err := detectValues(ds, content)
+	if err != nil {
+		return nil, err
+	}
+	svs = mergeDetectedValues(svs, dets)
+	if o.EncodedVariants {
+		svs = withEncodedVariants(svs)
+	}
+	return svs, nil
+}
+
+// logReplacements logs (if debugging) how many occurrences of
+// each sensitive value were replaced
+func (o *TransformOpts) logReplacements(action string, counts map[string]int) {
+	if !o.Debug {
+		return
+	}
+	names := make([]string, 0, len(counts))
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		log.Printf("%s %d occurrences of %s\n", action, counts[n], n)
+	}
 }
 
 // Transformable defines the set of actions which can be performed on some underlying
@@ -0,0 +1,80 @@
+package terrahelp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// minEncodedVariantLength is the minimum length an encoded variant must
+// have before it is considered, short variants (e.g. the base64 form of a
+// one character value) would otherwise cause spurious replacements
+const minEncodedVariantLength = 6
+
+var hclEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+	"${", "$${",
+	"%{", "%%{",
+)
+
+// EncodedVariants returns the common encoded forms of the value, i.e. how
+// it appears after passing through base64encode (std and url alphabets,
+// with and without padding), urlencode, jsonencode / JSON escaping
+// (as found within tfstate) and HCL escaping. Only variants which differ
+// from the value itself are returned.
+func EncodedVariants(v string) []string {
+	candidates := []string{
+		base64.StdEncoding.EncodeToString([]byte(v)),
+		base64.RawStdEncoding.EncodeToString([]byte(v)),
+		base64.URLEncoding.EncodeToString([]byte(v)),
+		base64.RawURLEncoding.EncodeToString([]byte(v)),
+		url.QueryEscape(v),
+		url.PathEscape(v),
+		jsonEscape(v, true),
+		jsonEscape(v, false),
+		hclEscaper.Replace(v),
+	}
+
+	seen := map[string]bool{v: true}
+	var variants []string
+	for _, c := range candidates {
+		if !seen[c] && len(c) >= minEncodedVariantLength {
+			seen[c] = true
+			variants = append(variants, c)
+		}
+	}
+	return variants
+}
+
+// jsonEscape returns the value as it would appear within a JSON string
+func jsonEscape(v string, escapeHTML bool) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(escapeHTML)
+	if err := enc.Encode(v); err != nil {
+		return v
+	}
+	s := strings.TrimSuffix(buf.String(), "\n")
+	return s[1 : len(s)-1]
+}
+
+// withEncodedVariants adds the encoded variants of each value to the
+// list of values to replace, each recorded as coming from the same
+// place as the value itself
+func withEncodedVariants(svs []SourcedValue) []SourcedValue {
+	all := append([]SourcedValue{}, svs...)
+	for _, sv := range svs {
+		for _, v := range EncodedVariants(sv.Value) {
+			variant := sv
+			variant.Value = v
+			all = append(all, variant)
+		}
+	}
+	return orderSourcedValues(all)
+}
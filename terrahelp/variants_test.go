@@ -0,0 +1,76 @@
+package terrahelp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodedVariants(t *testing.T) {
+	// When
+	variants := EncodedVariants(`pa"ss<wo>rd/?+`)
+
+	// Then
+	for _, v := range []string{
+		"cGEic3M8d28+cmQvPys=",       // base64 std
+		"cGEic3M8d28+cmQvPys",        // base64 std, no padding
+		"cGEic3M8d28-cmQvPys=",       // base64 url
+		"cGEic3M8d28-cmQvPys",        // base64 url, no padding
+		"pa%22ss%3Cwo%3Erd%2F%3F%2B", // urlencode
+		`pa\"ss\u003cwo\u003erd/?+`,  // JSON escaped (as within tfstate)
+		`pa\"ss<wo>rd/?+`,            // HCL escaped
+	} {
+		assert.Contains(t, variants, v)
+	}
+	assert.NotContains(t, variants, `pa"ss<wo>rd/?+`)
+}
+
+func TestEncodedVariants_SkipsShortVariants(t *testing.T) {
+	assert.Empty(t, EncodedVariants("ab"))
+}
+
+func TestMasker_Mask_StreamedEncodedSensitiveData(t *testing.T) {
+	// Given some input content ...
+	ctx, stdinSim, stdoutSim := defaultTestMaskOpts(t)
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	m := NewMasker(ctx, &DefaultReplaceables{
+		[]string{`sensitive-"value"-<2>`}})
+
+	// When we simulate piping this content (which contains
+	// encoded forms of the sensitive data) into stdIn
+	stdinSim.write(
+		`
+      + user_data = "c2Vuc2l0aXZlLSJ2YWx1ZSItPDI+"
+      + policy    = jsonencode({"secret": "sensitive-\"value\"-<2>"})
+      + url       = "https://example.com/?p=sensitive-%22value%22-%3C2%3E"`)
+	err := m.Mask()
+
+	// Then the encoded forms should be masked too
+	assert.NoError(t, err)
+	b := stdoutSim.getAllContent()
+	assert.Equal(t,
+		`
+      + user_data = "******"
+      + policy    = jsonencode({"secret": "******"})
+      + url       = "https://example.com/?p=******"`, b)
+}
+
+func TestMasker_Mask_StreamedEncodedSensitiveData_Disabled(t *testing.T) {
+	// Given some input content, and encoded variants disabled ...
+	ctx, stdinSim, stdoutSim := defaultTestMaskOpts(t)
+	ctx.EncodedVariants = false
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	m := NewMasker(ctx, &DefaultReplaceables{
+		[]string{`sensitive-"value"-<2>`}})
+
+	// When
+	data := `+ user_data = "c2Vuc2l0aXZlLSJ2YWx1ZSItPDI+"`
+	stdinSim.write(data)
+	err := m.Mask()
+
+	// Then the encoded forms should be left alone
+	assert.NoError(t, err)
+	assert.Equal(t, data, stdoutSim.getAllContent())
+}
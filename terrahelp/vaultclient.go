@@ -2,6 +2,8 @@ package terrahelp
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/hashicorp/vault/api"
 
@@ -25,6 +27,14 @@ type VaultClient interface {
 	Decrypt(key, ciphertext string) (string, error)
 }
 
+// VaultKVReader defines the functionality required by terrahelp
+// when reading secrets held in Vault's KV secrets engine
+type VaultKVReader interface {
+
+	// ReadKV returns the data held at the KV (v1 or v2) path
+	ReadKV(path string) (map[string]interface{}, error)
+}
+
 // DefaultVaultClient provides a wrapper around the core Vault
 // client and uses it to provide the required functionality
 type DefaultVaultClient struct {
@@ -154,3 +164,64 @@ func (v *DefaultVaultClient) encryptEndpoint(key string) string {
 func (v *DefaultVaultClient) decryptEndpoint(key string) string {
 	return "/transit/decrypt/" + key
 }
+
+// ReadKV returns the data held at the KV path, transparently catering
+// for both version 1 and version 2 of the KV secrets engine
+func (v *DefaultVaultClient) ReadKV(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+	mount, version, err := v.kvMountInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	readPath := path
+	if version == 2 {
+		readPath = mount + "data/" + strings.TrimPrefix(path, mount)
+	}
+	s, err := v.Logical().Read(readPath)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.Data == nil {
+		return nil, fmt.Errorf("No secret found at Vault KV path %s ", path)
+	}
+	if version == 2 {
+		data, ok := s.Data["data"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("No secret data found at Vault KV path %s ", path)
+		}
+		return data, nil
+	}
+	return s.Data, nil
+}
+
+// kvMountInfo determines the mount path and version of the KV
+// secrets engine the path resides within
+func (v *DefaultVaultClient) kvMountInfo(path string) (string, int, error) {
+	r := v.NewRequest("GET", "/v1/sys/internal/ui/mounts/"+path)
+	resp, err := v.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// Older versions of Vault do not expose the mount info, and
+		// only support version 1 of the KV secrets engine
+		return "", 1, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	s, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if s == nil || s.Data == nil {
+		return "", 0, fmt.Errorf("Unable to determine the KV mount for %s ", path)
+	}
+	mount, _ := s.Data["path"].(string)
+	if opts, ok := s.Data["options"].(map[string]interface{}); ok && opts["version"] == "2" {
+		return mount, 2, nil
+	}
+	return mount, 1, nil
+}
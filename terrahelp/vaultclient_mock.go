@@ -14,6 +14,7 @@ const vaultV1EncryptionPrefix = "vault:v1:"
 type MockVaultClient struct {
 	key            string
 	transitMounted bool
+	kv             map[string]map[string]interface{}
 }
 
 // NewMockVaultClient creates a new MockVaultClient
@@ -43,6 +44,23 @@ func (m *MockVaultClient) RegisterNamedEncryptionKey(key string) error {
 	return nil
 }
 
+// WriteKV stores the data at the mock KV path
+func (m *MockVaultClient) WriteKV(path string, data map[string]interface{}) {
+	if m.kv == nil {
+		m.kv = map[string]map[string]interface{}{}
+	}
+	m.kv[strings.Trim(path, "/")] = data
+}
+
+// ReadKV returns the data held at the mock KV path
+func (m *MockVaultClient) ReadKV(path string) (map[string]interface{}, error) {
+	data, ok := m.kv[strings.Trim(path, "/")]
+	if !ok {
+		return nil, fmt.Errorf("No secret found at Vault KV path %s ", path)
+	}
+	return data, nil
+}
+
 // Encrypt uses the named encryption key to mock encrypt the supplied content
 func (m *MockVaultClient) Encrypt(key, s string) (string, error) {
 	if !m.transitMounted {
@@ -0,0 +1,39 @@
+package terrahelp
+
+// VaultKVReplaceables provides the sensitive values held within one
+// or more Vault KV secrets, meaning no plaintext tfvars file needs
+// to exist locally in order to find them
+type VaultKVReplaceables struct {
+	reader VaultKVReader
+	paths  []string
+}
+
+// NewVaultKVReplaceables creates a new VaultKVReplaceables which reads
+// the secrets held at the KV (v1 or v2) paths
+func NewVaultKVReplaceables(r VaultKVReader, paths []string) *VaultKVReplaceables {
+	return &VaultKVReplaceables{reader: r, paths: paths}
+}
+
+// Values returns all of the (non empty) leaf string values held
+// within the secrets at the configured paths
+func (v *VaultKVReplaceables) Values() ([]string, error) {
+	svs, err := v.SourcedValues()
+	return values(svs), err
+}
+
+// SourcedValues returns all of the (non empty) leaf string values held
+// within the secrets at the configured paths, along with the path and
+// key each one came from
+func (v *VaultKVReplaceables) SourcedValues() ([]SourcedValue, error) {
+	var svs []SourcedValue
+	for _, p := range v.paths {
+		data, err := v.reader.ReadKV(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range stringLeaves("", data) {
+			svs = append(svs, SourcedValue{Value: l.Value, Source: "vault-kv:" + p, Variable: l.Variable})
+		}
+	}
+	return orderSourcedValues(svs), nil
+}
@@ -0,0 +1,139 @@
+package terrahelp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKVVaultClient() *MockVaultClient {
+	vc := NewMockVaultClient()
+	vc.WriteKV("secret/app/db", map[string]interface{}{
+		"username": "app-user-KDJHS",
+		"password": "app-password-SJDHF",
+		"port":     5432,
+	})
+	vc.WriteKV("/secret/app/api/", map[string]interface{}{
+		"tokens": []interface{}{"api-token-1-JDHS", "api-token-2-KSHD"},
+		"nested": map[string]interface{}{"key": "nested-api-key-DJSH", "empty": ""},
+	})
+	return vc
+}
+
+func TestVaultKVReplaceables_Values(t *testing.T) {
+	// Given
+	r := NewVaultKVReplaceables(newTestKVVaultClient(), []string{"secret/app/db", "secret/app/api"})
+
+	// When
+	actual, err := r.Values()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"nested-api-key-DJSH",
+		"app-password-SJDHF",
+		"api-token-2-KSHD",
+		"api-token-1-JDHS",
+		"app-user-KDJHS"}, actual)
+}
+
+func TestVaultKVReplaceables_Values_MissingPath(t *testing.T) {
+	// Given
+	r := NewVaultKVReplaceables(newTestKVVaultClient(), []string{"secret/app/missing"})
+
+	// When
+	_, err := r.Values()
+
+	// Then
+	assert.Error(t, err)
+}
+
+func TestMasker_Mask_StreamedVaultKVSensitiveData(t *testing.T) {
+	// Given some input content, and sensitive values held in Vault ...
+	ctx, stdinSim, stdoutSim := defaultTestMaskOpts(t)
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	m := NewMasker(ctx, NewVaultKVReplaceables(newTestKVVaultClient(), []string{"secret/app/db"}))
+
+	// When
+	stdinSim.write(`+ connection = "app-user-KDJHS/app-password-SJDHF"`)
+	err := m.Mask()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, `+ connection = "******/******"`, stdoutSim.getAllContent())
+}
+
+func TestCryptoHandler_VaultEncrypter_Encrypt_StreamedVaultKVSensitiveData(t *testing.T) {
+	// Given no tfvars file, but sensitive values held in Vault ...
+	tu, _ := newInitVaultEncryptableCrytoHandler(t, ThNamedEncryptionKey)
+	ctx, stdinSim, stdoutSim := defaultTestInlinePipedCryptoHandlerOpts(t)
+	defer stdinSim.end()
+	defer stdoutSim.end()
+	ctx.TfvarsFilename = "does-not-exist.tfvars"
+	ctx.Replaceables = NewVaultKVReplaceables(newTestKVVaultClient(), []string{"secret/app/db"})
+
+	// When
+	stdinSim.write(`password = "app-password-SJDHF"`)
+	err := tu.Encrypt(ctx)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, `password = "@terrahelp-encrypted(vault:v1:WVhCd0xYQmhjM04zYjNKa0xWTktSRWhH)"`, stdoutSim.getAllContent())
+}
+
+func newTestVaultServer(t *testing.T, responses map[string]string) *DefaultVaultClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+	c, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("Unable to create test Vault client : %s", err)
+	}
+	c.SetToken("test-token")
+	return &DefaultVaultClient{c}
+}
+
+func TestDefaultVaultClient_ReadKV_V2(t *testing.T) {
+	// Given
+	vc := newTestVaultServer(t, map[string]string{
+		"/v1/sys/internal/ui/mounts/kv/app/db": `{"data":{"path":"kv/","type":"kv","options":{"version":"2"}}}`,
+		"/v1/kv/data/app/db":                   `{"data":{"data":{"password":"v2-password"},"metadata":{"version":3}}}`,
+	})
+
+	// When
+	data, err := vc.ReadKV("kv/app/db")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "v2-password"}, data)
+}
+
+func TestDefaultVaultClient_ReadKV_V1(t *testing.T) {
+	// Given
+	vc := newTestVaultServer(t, map[string]string{
+		"/v1/sys/internal/ui/mounts/secret/app/db": `{"data":{"path":"secret/","type":"kv","options":null}}`,
+		"/v1/secret/app/db":                        `{"data":{"password":"v1-password"}}`,
+	})
+
+	// When
+	data, err := vc.ReadKV("secret/app/db")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "v1-password"}, data)
+}